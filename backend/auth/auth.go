@@ -0,0 +1,258 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 认证：本地用户（bcrypt 密码）登录后获得会话 Token（保存在内存中，重启后需重新登录），
+// 脚本使用长期有效的 API Token（只保存 SHA-256 摘要，见 token.go）。
+
+type User struct {
+	Username     string `yaml:"username"`
+	PasswordHash string `yaml:"password_hash"` // bcrypt 摘要，可用 `system-monitor hash-password` 生成
+	Role         Role   `yaml:"role"`          // viewer（默认）/ operator / admin
+}
+
+// Role 决定可访问的数据与操作，高级角色拥有低级角色的全部权限：
+// viewer 只能查看性能指标；operator 额外可查看安全审计数据（网络日志、连接、地理分布）并确认告警；
+// admin 额外可修改配置、触发局域网扫描。
+type Role string
+
+const (
+	RoleViewer   Role = "viewer"
+	RoleOperator Role = "operator"
+	RoleAdmin    Role = "admin"
+)
+
+var roleLevels = map[Role]int{RoleViewer: 1, RoleOperator: 2, RoleAdmin: 3}
+
+func (r Role) valid() bool {
+	_, ok := roleLevels[r]
+	return ok
+}
+
+// Allows 判断 r 是否拥有 min 角色的权限
+func (r Role) Allows(min Role) bool {
+	return roleLevels[r] >= roleLevels[min]
+}
+
+type Config struct {
+	Enabled    bool          `yaml:"enabled"`     // 为 false 时关闭认证（仅用于本机调试）
+	Users      []User        `yaml:"users"`       // 为空时启动时生成一个随机密码的 admin 用户
+	SessionTTL time.Duration `yaml:"session_ttl"` // 登录会话有效期
+	TokensPath string        `yaml:"tokens_path"` // API Token 存储文件
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Enabled:    true,
+		SessionTTL: 12 * time.Hour,
+		TokensPath: "tokens.json",
+	}
+}
+
+func (c Config) Validate() error {
+	if c.SessionTTL < time.Minute {
+		return errors.New("session_ttl must be at least 1m")
+	}
+	if c.TokensPath == "" {
+		return errors.New("tokens_path is required")
+	}
+	seen := make(map[string]bool)
+	for i, u := range c.Users {
+		if u.Username == "" {
+			return fmt.Errorf("user #%d: username is required", i+1)
+		}
+		if seen[u.Username] {
+			return fmt.Errorf("user #%d: duplicate username %q", i+1, u.Username)
+		}
+		seen[u.Username] = true
+		if _, err := bcrypt.Cost([]byte(u.PasswordHash)); err != nil {
+			return fmt.Errorf("user %q: password_hash is not a bcrypt hash", u.Username)
+		}
+		if u.Role != "" && !u.Role.valid() {
+			return fmt.Errorf("user %q: role must be viewer, operator or admin, got %q", u.Username, u.Role)
+		}
+	}
+	return nil
+}
+
+var (
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrTokenNotFound      = errors.New("token not found")
+)
+
+// Principal 是通过认证的调用方
+type Principal struct {
+	Username string `json:"username"`
+	Role     Role   `json:"role"`
+	Method   string `json:"method"` // session / token / cert / disabled
+}
+
+type session struct {
+	username string
+	expires  time.Time
+}
+
+var (
+	mu        sync.RWMutex
+	cfg       = DefaultConfig()
+	users     = make(map[string]User)    // username -> 用户（已补齐默认角色）
+	bootstrap string                     // 未配置用户时生成的 admin 密码摘要，重新加载配置时保持不变
+	sessions  = make(map[string]session) // SHA-256(会话 Token) -> 会话
+)
+
+// dummyHash 用于用户名不存在时仍执行一次 bcrypt 比较，避免通过响应时间枚举用户名
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+
+// SetConfig 应用认证配置，可在运行中重复调用；已登录的会话保持有效
+func SetConfig(c Config) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	next := make(map[string]User, len(c.Users))
+	for _, u := range c.Users {
+		if u.Role == "" {
+			u.Role = RoleViewer
+		}
+		next[u.Username] = u
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(next) == 0 && c.Enabled {
+		if bootstrap == "" {
+			pw := randomToken(12)
+			h, err := bcrypt.GenerateFromPassword([]byte(pw), bcrypt.DefaultCost)
+			if err != nil {
+				return err
+			}
+			bootstrap = string(h)
+			fmt.Printf("[WARN] No users configured in auth.users. Generated user admin with password %s (valid until restart).\n", pw)
+		}
+		next["admin"] = User{Username: "admin", PasswordHash: bootstrap, Role: RoleAdmin}
+	}
+	// 被删除的用户立即失效
+	for k, s := range sessions {
+		if _, ok := next[s.username]; !ok {
+			delete(sessions, k)
+		}
+	}
+	tokensChanged := cfg.TokensPath != c.TokensPath
+	cfg, users = c, next
+	if tokensChanged || !tokensLoaded {
+		if err := loadTokens(c.TokensPath); err != nil {
+			fmt.Printf("[ERROR] Failed to load API tokens from %s: %v\n", c.TokensPath, err)
+		}
+	}
+	return nil
+}
+
+// Enabled 返回是否启用认证
+func Enabled() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return cfg.Enabled
+}
+
+// Login 校验用户名密码，成功后返回新的会话 Token 及其过期时间
+func Login(username, password string) (string, time.Time, error) {
+	mu.RLock()
+	u, ok := users[username]
+	ttl := cfg.SessionTTL
+	mu.RUnlock()
+	if !ok {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return "", time.Time{}, ErrInvalidCredentials
+	}
+	if bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) != nil {
+		return "", time.Time{}, ErrInvalidCredentials
+	}
+
+	token := randomToken(32)
+	expires := time.Now().Add(ttl)
+	mu.Lock()
+	now := time.Now()
+	for k, s := range sessions {
+		if now.After(s.expires) {
+			delete(sessions, k)
+		}
+	}
+	sessions[digest(token)] = session{username: username, expires: expires}
+	mu.Unlock()
+	return token, expires, nil
+}
+
+// Logout 注销会话 Token
+func Logout(token string) {
+	mu.Lock()
+	delete(sessions, digest(token))
+	mu.Unlock()
+}
+
+// Authenticate 校验会话 Token 或 API Token
+func Authenticate(token string) (Principal, bool) {
+	if token == "" {
+		return Principal{}, false
+	}
+	d := digest(token)
+	mu.Lock()
+	defer mu.Unlock()
+	if s, ok := sessions[d]; ok {
+		if time.Now().After(s.expires) {
+			delete(sessions, d)
+			return Principal{}, false
+		}
+		// 角色按当前配置实时取值，修改后无需重新登录
+		if u, ok := users[s.username]; ok {
+			return Principal{Username: s.username, Role: u.Role, Method: "session"}, true
+		}
+		return Principal{}, false
+	}
+	if t := tokenByDigest(d); t != nil {
+		u, ok := users[t.Username]
+		if !ok {
+			return Principal{}, false // 用户已被删除
+		}
+		t.LastUsed = time.Now().Unix()
+		return Principal{Username: t.Username, Role: u.Role, Method: "token"}, true
+	}
+	return Principal{}, false
+}
+
+// AuthenticateCert 把已通过 mTLS 校验的客户端证书映射为同名（证书 CN）用户
+func AuthenticateCert(commonName string) (Principal, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	u, ok := users[commonName]
+	if !ok || commonName == "" {
+		return Principal{}, false
+	}
+	return Principal{Username: u.Username, Role: u.Role, Method: "cert"}, true
+}
+
+// HashPassword 生成 bcrypt 摘要，供 hash-password 子命令使用
+func HashPassword(password string) (string, error) {
+	h, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(h), err
+}
+
+func randomToken(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func digest(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
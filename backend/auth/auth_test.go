@@ -0,0 +1,232 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func testHash(t *testing.T, password string) string {
+	t.Helper()
+	h, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(h)
+}
+
+// setTestConfig 应用只含给定用户的配置，Token 文件放在临时目录
+func setTestConfig(t *testing.T, users ...User) Config {
+	t.Helper()
+	c := DefaultConfig()
+	c.Users = users
+	c.TokensPath = filepath.Join(t.TempDir(), "tokens.json")
+	if err := SetConfig(c); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestRoleAllows(t *testing.T) {
+	tests := []struct {
+		role, min Role
+		want      bool
+	}{
+		{RoleViewer, RoleViewer, true},
+		{RoleViewer, RoleOperator, false},
+		{RoleViewer, RoleAdmin, false},
+		{RoleOperator, RoleViewer, true},
+		{RoleOperator, RoleOperator, true},
+		{RoleOperator, RoleAdmin, false},
+		{RoleAdmin, RoleViewer, true},
+		{RoleAdmin, RoleAdmin, true},
+		{"", RoleViewer, false},
+		{"root", RoleViewer, false},
+	}
+	for _, tt := range tests {
+		if got := tt.role.Allows(tt.min); got != tt.want {
+			t.Errorf("%q.Allows(%q) = %v, want %v", tt.role, tt.min, got, tt.want)
+		}
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	hash := testHash(t, "pw")
+	tests := []struct {
+		name    string
+		mutate  func(*Config)
+		wantErr string
+	}{
+		{"default", func(c *Config) {}, ""},
+		{"users", func(c *Config) {
+			c.Users = []User{{Username: "a", PasswordHash: hash, Role: RoleAdmin}, {Username: "b", PasswordHash: hash}}
+		}, ""},
+		{"short ttl", func(c *Config) { c.SessionTTL = time.Second }, "session_ttl"},
+		{"no tokens path", func(c *Config) { c.TokensPath = "" }, "tokens_path"},
+		{"no username", func(c *Config) { c.Users = []User{{PasswordHash: hash}} }, "username is required"},
+		{"duplicate", func(c *Config) {
+			c.Users = []User{{Username: "a", PasswordHash: hash}, {Username: "a", PasswordHash: hash}}
+		}, "duplicate"},
+		{"plain password", func(c *Config) { c.Users = []User{{Username: "a", PasswordHash: "secret"}} }, "bcrypt"},
+		{"bad role", func(c *Config) { c.Users = []User{{Username: "a", PasswordHash: hash, Role: "root"}} }, "role must be"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := DefaultConfig()
+			tt.mutate(&c)
+			err := c.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoginAndSessions(t *testing.T) {
+	c := setTestConfig(t,
+		User{Username: "alice", PasswordHash: testHash(t, "alice-pw"), Role: RoleOperator},
+		User{Username: "bob", PasswordHash: testHash(t, "bob-pw")},
+	)
+
+	tests := []struct {
+		user, password string
+		wantRole       Role
+		wantErr        bool
+	}{
+		{"alice", "alice-pw", RoleOperator, false},
+		{"bob", "bob-pw", RoleViewer, false}, // 未设置角色时为 viewer
+		{"alice", "wrong", "", true},
+		{"nobody", "alice-pw", "", true},
+	}
+	for _, tt := range tests {
+		token, expires, err := Login(tt.user, tt.password)
+		if tt.wantErr {
+			if err != ErrInvalidCredentials {
+				t.Errorf("Login(%s, %s) err = %v", tt.user, tt.password, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Login(%s): %v", tt.user, err)
+		}
+		if time.Until(expires) > c.SessionTTL || time.Until(expires) < c.SessionTTL-time.Minute {
+			t.Errorf("expires = %s", expires)
+		}
+		p, ok := Authenticate(token)
+		if !ok || p.Username != tt.user || p.Role != tt.wantRole || p.Method != "session" {
+			t.Errorf("Authenticate(%s session) = %+v, %v", tt.user, p, ok)
+		}
+	}
+
+	token, _, _ := Login("alice", "alice-pw")
+	if _, ok := Authenticate(token + "x"); ok {
+		t.Error("tampered token accepted")
+	}
+	if _, ok := Authenticate(""); ok {
+		t.Error("empty token accepted")
+	}
+
+	// 角色按当前配置取值，修改后无需重新登录
+	c.Users = []User{{Username: "alice", PasswordHash: testHash(t, "alice-pw"), Role: RoleAdmin}}
+	if err := SetConfig(c); err != nil {
+		t.Fatal(err)
+	}
+	if p, ok := Authenticate(token); !ok || p.Role != RoleAdmin {
+		t.Errorf("after role change = %+v, %v", p, ok)
+	}
+	Logout(token)
+	if _, ok := Authenticate(token); ok {
+		t.Error("session valid after logout")
+	}
+}
+
+func TestAPITokens(t *testing.T) {
+	c := setTestConfig(t,
+		User{Username: "alice", PasswordHash: testHash(t, "pw"), Role: RoleOperator},
+		User{Username: "bob", PasswordHash: testHash(t, "pw")},
+	)
+
+	if _, _, err := CreateToken("alice", ""); err == nil {
+		t.Error("token without name accepted")
+	}
+	plain, meta, err := CreateToken("alice", "ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(plain, TokenPrefix) {
+		t.Errorf("token %q lacks prefix", plain)
+	}
+	p, ok := Authenticate(plain)
+	if !ok || p.Username != "alice" || p.Role != RoleOperator || p.Method != "token" {
+		t.Errorf("Authenticate(token) = %+v, %v", p, ok)
+	}
+
+	// 文件只保存摘要，权限为 0600
+	b, err := os.ReadFile(c.TokensPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), plain) || !strings.Contains(string(b), digest(plain)) {
+		t.Errorf("tokens file = %s", b)
+	}
+	if st, _ := os.Stat(c.TokensPath); st.Mode().Perm() != 0o600 {
+		t.Errorf("tokens file mode = %v", st.Mode())
+	}
+
+	list := ListTokens("alice")
+	if len(list) != 1 || list[0].ID != meta.ID || list[0].Digest != "" {
+		t.Errorf("ListTokens = %+v", list)
+	}
+	if len(ListTokens("bob")) != 0 {
+		t.Error("bob sees alice's token")
+	}
+	if err := DeleteToken("bob", meta.ID); err != ErrTokenNotFound {
+		t.Errorf("bob deleted alice's token: %v", err)
+	}
+
+	// 重新加载配置后从文件恢复；Token 继承用户当前的角色
+	c.Users[0].Role = RoleViewer
+	tokensLoaded = false
+	if err := SetConfig(c); err != nil {
+		t.Fatal(err)
+	}
+	if p, ok := Authenticate(plain); !ok || p.Role != RoleViewer {
+		t.Errorf("after reload = %+v, %v", p, ok)
+	}
+
+	if err := DeleteToken("alice", meta.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := Authenticate(plain); ok {
+		t.Error("deleted token accepted")
+	}
+}
+
+func TestAuthenticateCert(t *testing.T) {
+	setTestConfig(t, User{Username: "agent", PasswordHash: testHash(t, "pw"), Role: RoleOperator})
+	tests := []struct {
+		cn   string
+		ok   bool
+		role Role
+	}{
+		{"agent", true, RoleOperator},
+		{"unknown", false, ""},
+		{"", false, ""},
+	}
+	for _, tt := range tests {
+		p, ok := AuthenticateCert(tt.cn)
+		if ok != tt.ok || p.Role != tt.role || (ok && p.Method != "cert") {
+			t.Errorf("AuthenticateCert(%q) = %+v, %v", tt.cn, p, ok)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// APIToken 是供脚本使用的长期 Token，明文只在创建时返回一次
+type APIToken struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Username  string `json:"username"`         // 创建者，Token 继承其权限
+	Digest    string `json:"digest,omitempty"` // SHA-256(明文)
+	CreatedAt int64  `json:"created_at"`
+	LastUsed  int64  `json:"last_used,omitempty"`
+}
+
+// TokenPrefix 便于在日志或代码中识别泄露的 Token
+const TokenPrefix = "smt_"
+
+var (
+	tokens       []*APIToken // 受 mu 保护
+	tokensLoaded bool
+)
+
+// loadTokens 读取 Token 文件，文件不存在时视为空；调用方需持有 mu 写锁
+func loadTokens(path string) error {
+	tokens, tokensLoaded = nil, true
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, &tokens)
+}
+
+// saveTokens 原子地写回 Token 文件；调用方需持有 mu 写锁
+func saveTokens() error {
+	b, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(cfg.TokensPath), ".tokens-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), cfg.TokensPath)
+}
+
+func tokenByDigest(d string) *APIToken {
+	for _, t := range tokens {
+		if t.Digest == d {
+			return t
+		}
+	}
+	return nil
+}
+
+// CreateToken 为 username 创建 API Token，返回明文（只此一次）与元数据
+func CreateToken(username, name string) (string, APIToken, error) {
+	if name == "" {
+		return "", APIToken{}, fmt.Errorf("name is required")
+	}
+	plain := TokenPrefix + randomToken(24)
+	t := &APIToken{
+		ID:        randomToken(6),
+		Name:      name,
+		Username:  username,
+		Digest:    digest(plain),
+		CreatedAt: time.Now().Unix(),
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	tokens = append(tokens, t)
+	if err := saveTokens(); err != nil {
+		tokens = tokens[:len(tokens)-1]
+		return "", APIToken{}, err
+	}
+	return plain, *t, nil
+}
+
+// ListTokens 返回 username 创建的 Token（不含摘要），按创建时间排序
+func ListTokens(username string) []APIToken {
+	mu.RLock()
+	defer mu.RUnlock()
+	out := []APIToken{}
+	for _, t := range tokens {
+		if t.Username == username {
+			c := *t
+			c.Digest = ""
+			out = append(out, c)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt < out[j].CreatedAt })
+	return out
+}
+
+// DeleteToken 吊销 username 名下的 Token
+func DeleteToken(username, id string) error {
+	mu.Lock()
+	defer mu.Unlock()
+	for i, t := range tokens {
+		if t.ID == id && t.Username == username {
+			tokens = append(tokens[:i], tokens[i+1:]...)
+			if err := saveTokens(); err != nil {
+				tokens = append(tokens[:i], append([]*APIToken{t}, tokens[i:]...)...)
+				return err
+			}
+			return nil
+		}
+	}
+	return ErrTokenNotFound
+}
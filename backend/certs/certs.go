@@ -0,0 +1,225 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// HTTPS 与双向 TLS：证书文件修改后自动重新加载（每次握手最多每 5 秒检查一次修改时间），
+// 可在首次启动时生成自签名证书。
+
+type Config struct {
+	Enabled      bool   `yaml:"enabled"`
+	CertFile     string `yaml:"cert_file"`
+	KeyFile      string `yaml:"key_file"`
+	SelfSigned   bool   `yaml:"self_signed"`    // 证书文件不存在时生成自签名证书
+	ClientCAFile string `yaml:"client_ca_file"` // 设置后校验客户端证书（mTLS）
+	ClientAuth   string `yaml:"client_auth"`    // optional（默认，有证书则校验）/ require（必须提供证书）
+}
+
+func DefaultConfig() Config {
+	return Config{
+		CertFile:   "server.crt",
+		KeyFile:    "server.key",
+		ClientAuth: "optional",
+	}
+}
+
+func (c Config) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.CertFile == "" || c.KeyFile == "" {
+		return errors.New("cert_file and key_file are required")
+	}
+	if c.ClientAuth != "optional" && c.ClientAuth != "require" {
+		return fmt.Errorf("client_auth must be optional or require, got %q", c.ClientAuth)
+	}
+	if c.ClientAuth == "require" && c.ClientCAFile == "" {
+		return errors.New("client_auth require needs client_ca_file")
+	}
+	return nil
+}
+
+const checkInterval = 5 * time.Second
+
+// Manager 持有当前证书与客户端 CA，并在文件变化时重新加载
+type Manager struct {
+	cfg Config
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	certMod   time.Time
+	keyMod    time.Time
+	caMod     time.Time
+	lastCheck time.Time
+}
+
+// NewManager 加载证书（必要时先生成自签名证书），失败时返回错误
+func NewManager(c Config) (*Manager, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	if c.SelfSigned {
+		if _, err := os.Stat(c.CertFile); os.IsNotExist(err) {
+			if err := generateSelfSigned(c.CertFile, c.KeyFile); err != nil {
+				return nil, fmt.Errorf("generate self-signed certificate: %w", err)
+			}
+			fmt.Printf("[INFO] Generated self-signed certificate %s\n", c.CertFile)
+		}
+	}
+	m := &Manager{cfg: c}
+	if err := m.reload(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// TLSConfig 返回用于 http.Server 的配置，每次握手都使用最新的证书与 CA
+func (m *Manager) TLSConfig() *tls.Config {
+	base := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		m.maybeReload()
+		m.mu.RLock()
+		defer m.mu.RUnlock()
+		// 返回的配置整体替换 base，需带上 ALPN 协议，否则 HTTP/2 协商不到
+		tc := &tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			NextProtos:   base.NextProtos,
+			Certificates: []tls.Certificate{*m.cert},
+		}
+		if m.clientCAs != nil {
+			tc.ClientCAs = m.clientCAs
+			tc.ClientAuth = tls.VerifyClientCertIfGiven
+			if m.cfg.ClientAuth == "require" {
+				tc.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+		}
+		return tc, nil
+	}
+	return base
+}
+
+func (m *Manager) maybeReload() {
+	m.mu.Lock()
+	if time.Since(m.lastCheck) < checkInterval {
+		m.mu.Unlock()
+		return
+	}
+	m.lastCheck = time.Now()
+	changed := modTime(m.cfg.CertFile) != m.certMod || modTime(m.cfg.KeyFile) != m.keyMod ||
+		(m.cfg.ClientCAFile != "" && modTime(m.cfg.ClientCAFile) != m.caMod)
+	m.mu.Unlock()
+	if !changed {
+		return
+	}
+	if err := m.reload(); err != nil {
+		fmt.Printf("[ERROR] TLS certificate reload failed, keeping previous certificate: %v\n", err)
+		return
+	}
+	fmt.Println("[INFO] TLS certificate reloaded")
+}
+
+func (m *Manager) reload() error {
+	certMod, keyMod := modTime(m.cfg.CertFile), modTime(m.cfg.KeyFile)
+	cert, err := tls.LoadX509KeyPair(m.cfg.CertFile, m.cfg.KeyFile)
+	if err != nil {
+		return err
+	}
+	var pool *x509.CertPool
+	var caMod time.Time
+	if m.cfg.ClientCAFile != "" {
+		caMod = modTime(m.cfg.ClientCAFile)
+		b, err := os.ReadFile(m.cfg.ClientCAFile)
+		if err != nil {
+			return err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return fmt.Errorf("no certificates found in %s", m.cfg.ClientCAFile)
+		}
+	}
+	m.mu.Lock()
+	m.cert, m.clientCAs = &cert, pool
+	m.certMod, m.keyMod, m.caMod = certMod, keyMod, caMod
+	m.lastCheck = time.Now()
+	m.mu.Unlock()
+	return nil
+}
+
+func modTime(path string) time.Time {
+	st, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return st.ModTime()
+}
+
+// generateSelfSigned 生成有效期一年的 ECDSA 自签名证书，包含主机名、localhost 与本机所有 IP
+func generateSelfSigned(certFile, keyFile string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+	hostname, _ := os.Hostname()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: hostname, Organization: []string{"system-monitor"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+	}
+	if hostname != "" {
+		tmpl.DNSNames = append(tmpl.DNSNames, hostname)
+	}
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, a := range addrs {
+			if ipnet, ok := a.(*net.IPNet); ok {
+				tmpl.IPAddresses = append(tmpl.IPAddresses, ipnet.IP)
+			}
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	for _, f := range []string{certFile, keyFile} {
+		if dir := filepath.Dir(f); dir != "" {
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				return err
+			}
+		}
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		return err
+	}
+	return os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644)
+}
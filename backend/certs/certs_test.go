@@ -0,0 +1,210 @@
+package certs
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	ok := DefaultConfig()
+	ok.Enabled = true
+	tests := []struct {
+		name    string
+		mutate  func(c *Config)
+		wantErr bool
+	}{
+		{"default", func(c *Config) {}, false},
+		{"disabled ignores fields", func(c *Config) { c.Enabled = false; c.CertFile = "" }, false},
+		{"missing key", func(c *Config) { c.KeyFile = "" }, true},
+		{"bad client_auth", func(c *Config) { c.ClientAuth = "always" }, true},
+		{"require without ca", func(c *Config) { c.ClientAuth = "require" }, true},
+		{"require with ca", func(c *Config) { c.ClientAuth = "require"; c.ClientCAFile = "ca.pem" }, false},
+	}
+	for _, tt := range tests {
+		c := ok
+		tt.mutate(&c)
+		if err := c.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v", tt.name, err)
+		}
+	}
+}
+
+// testConfig 返回证书位于临时目录（尚不存在的子目录）的配置
+func testConfig(t *testing.T) Config {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "tls")
+	c := DefaultConfig()
+	c.Enabled = true
+	c.SelfSigned = true
+	c.CertFile = filepath.Join(dir, "server.crt")
+	c.KeyFile = filepath.Join(dir, "server.key")
+	return c
+}
+
+// served 返回握手时实际使用的证书
+func served(t *testing.T, m *Manager) *x509.Certificate {
+	t.Helper()
+	tc, err := m.TLSConfig().GetConfigForClient(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(tc.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestSelfSignedBootstrap(t *testing.T) {
+	c := testConfig(t)
+	m, err := NewManager(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st, err := os.Stat(c.KeyFile); err != nil || st.Mode().Perm() != 0o600 {
+		t.Fatalf("key file: %v, %v", st, err)
+	}
+	cert := served(t, m)
+	if err := cert.VerifyHostname("localhost"); err != nil {
+		t.Error(err)
+	}
+	if err := cert.VerifyHostname("127.0.0.1"); err != nil {
+		t.Error(err)
+	}
+	if cert.NotAfter.Before(time.Now().AddDate(0, 11, 0)) {
+		t.Errorf("expires %v", cert.NotAfter)
+	}
+
+	// 已有证书时不再重新生成
+	before, _ := os.ReadFile(c.CertFile)
+	if _, err := NewManager(c); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := os.ReadFile(c.CertFile); !bytes.Equal(before, after) {
+		t.Error("existing certificate regenerated")
+	}
+
+	// 未开启 self_signed 时证书缺失直接报错
+	c = testConfig(t)
+	c.SelfSigned = false
+	if _, err := NewManager(c); err == nil {
+		t.Error("missing certificate accepted")
+	}
+}
+
+func TestReload(t *testing.T) {
+	c := testConfig(t)
+	m, err := NewManager(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := served(t, m)
+
+	// touch 把修改时间推后，保证与首次加载时不同
+	touch := func() {
+		later := time.Now().Add(time.Minute)
+		os.Chtimes(c.CertFile, later, later)
+		os.Chtimes(c.KeyFile, later, later)
+	}
+	if err := generateSelfSigned(c.CertFile, c.KeyFile); err != nil {
+		t.Fatal(err)
+	}
+	touch()
+	if got := served(t, m); !got.Equal(first) {
+		t.Fatal("reloaded within check interval")
+	}
+	m.mu.Lock()
+	m.lastCheck = time.Time{}
+	m.mu.Unlock()
+	second := served(t, m)
+	if second.Equal(first) {
+		t.Fatal("certificate not reloaded after change")
+	}
+
+	// 新文件无效时保留之前的证书
+	os.WriteFile(c.CertFile, []byte("not a certificate"), 0o644)
+	later := time.Now().Add(2 * time.Minute)
+	os.Chtimes(c.CertFile, later, later)
+	m.mu.Lock()
+	m.lastCheck = time.Time{}
+	m.mu.Unlock()
+	if got := served(t, m); !got.Equal(second) {
+		t.Error("broken certificate replaced the previous one")
+	}
+}
+
+func TestClientAuth(t *testing.T) {
+	c := testConfig(t)
+	if _, err := NewManager(c); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		clientAuth string
+		caFile     string
+		want       tls.ClientAuthType
+	}{
+		{"optional", "", tls.NoClientCert},
+		{"optional", c.CertFile, tls.VerifyClientCertIfGiven},
+		{"require", c.CertFile, tls.RequireAndVerifyClientCert},
+	}
+	for _, tt := range tests {
+		cc := c
+		cc.ClientAuth, cc.ClientCAFile = tt.clientAuth, tt.caFile
+		m, err := NewManager(cc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tc, _ := m.TLSConfig().GetConfigForClient(&tls.ClientHelloInfo{})
+		if tc.ClientAuth != tt.want || (tt.caFile != "") != (tc.ClientCAs != nil) {
+			t.Errorf("%s/%q: client auth = %v", tt.clientAuth, tt.caFile, tc.ClientAuth)
+		}
+		if len(tc.NextProtos) == 0 || tc.NextProtos[0] != "h2" {
+			t.Errorf("next protos = %v", tc.NextProtos)
+		}
+	}
+
+	// CA 文件中没有证书时启动失败
+	bad := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(bad, []byte("junk"), 0o644)
+	c.ClientCAFile = bad
+	if _, err := NewManager(c); err == nil {
+		t.Error("empty client CA accepted")
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	c := testConfig(t)
+	m, err := NewManager(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", m.TLSConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	pool := x509.NewCertPool()
+	pem, _ := os.ReadFile(c.CertFile)
+	pool.AppendCertsFromPEM(pem)
+	conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{RootCAs: pool, ServerName: "localhost", NextProtos: []string{"h2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if p := conn.ConnectionState().NegotiatedProtocol; p != "h2" {
+		t.Errorf("negotiated %q, want h2", p)
+	}
+}
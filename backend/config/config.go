@@ -0,0 +1,316 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"system-monitor/auth"
+	"system-monitor/certs"
+	"system-monitor/fleet"
+	"system-monitor/lan"
+	"system-monitor/metrics"
+	"system-monitor/notify"
+
+	"github.com/goccy/go-yaml"
+)
+
+// 统一配置文件：默认值 <- 环境变量（兼容旧部署方式）<- 配置文件（CONFIG_PATH，默认 config.yaml）。
+// 收到 SIGHUP 或检测到文件修改时重新加载，新配置校验失败则保留旧配置。
+
+type ServerConfig struct {
+	Port int          `yaml:"port"` // 监听端口，修改后需重启
+	TLS  certs.Config `yaml:"tls"`  // HTTPS / mTLS，修改后需重启（证书文件本身会自动重新加载）
+}
+
+type Config struct {
+	Server  ServerConfig   `yaml:"server"`
+	Auth    auth.Config    `yaml:"auth"`
+	Metrics metrics.Config `yaml:"metrics"`
+	Notify  notify.Config  `yaml:"notify"`
+	LAN     lan.Config     `yaml:"lan"`
+	Fleet   fleet.Config   `yaml:"fleet"`
+}
+
+func Default() Config {
+	return Config{
+		Server:  ServerConfig{Port: 8080, TLS: certs.DefaultConfig()},
+		Auth:    auth.DefaultConfig(),
+		Metrics: metrics.DefaultConfig(),
+		LAN:     lan.DefaultConfig(),
+		Fleet:   fleet.DefaultConfig(),
+	}
+}
+
+func (c Config) Validate() error {
+	if c.Server.Port <= 0 || c.Server.Port > 65535 {
+		return errors.New("server.port must be in 1-65535")
+	}
+	if err := c.Server.TLS.Validate(); err != nil {
+		return fmt.Errorf("server.tls: %w", err)
+	}
+	if err := c.Auth.Validate(); err != nil {
+		return fmt.Errorf("auth: %w", err)
+	}
+	if err := c.Metrics.Validate(); err != nil {
+		return fmt.Errorf("metrics: %w", err)
+	}
+	if err := c.Notify.Validate(); err != nil {
+		return fmt.Errorf("notify: %w", err)
+	}
+	if err := c.LAN.Validate(); err != nil {
+		return fmt.Errorf("lan: %w", err)
+	}
+	if err := c.Fleet.Validate(); err != nil {
+		return fmt.Errorf("fleet: %w", err)
+	}
+	return nil
+}
+
+var (
+	mu        sync.RWMutex
+	current   Config
+	path      string
+	modTime   time.Time // 最近一次加载时配置文件的修改时间，文件不存在时为零值
+	agentOnly bool
+)
+
+// SetAgentOnly 切换为只采集并推送的 agent 模式，需在 Init 前调用：
+// 不加载用户与 Token，不打开历史数据库，不启动局域网扫描与联邦协程，也不发送告警通知
+func SetAgentOnly() {
+	mu.Lock()
+	agentOnly = true
+	mu.Unlock()
+}
+
+// Current 返回当前生效的配置
+func Current() Config {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
+
+// Path 返回配置文件路径
+func Path() string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return path
+}
+
+// Init 加载并应用配置，配置非法时返回错误（启动失败）
+func Init() error {
+	p := os.Getenv("CONFIG_PATH")
+	if p == "" {
+		p = "config.yaml"
+	}
+	c, mt, err := load(p)
+	if err != nil {
+		return err
+	}
+	if err := Apply(c); err != nil {
+		return err
+	}
+	mu.Lock()
+	path, modTime = p, mt
+	mu.Unlock()
+	if mt.IsZero() {
+		fmt.Printf("[INFO] Config file %s not found, using defaults and environment variables.\n", p)
+	} else {
+		fmt.Printf("[INFO] Config loaded from %s\n", p)
+	}
+	return nil
+}
+
+// load 按 默认值 <- 环境变量 <- 配置文件 的顺序合成配置并校验
+func load(p string) (Config, time.Time, error) {
+	c := Default()
+	applyEnv(&c)
+
+	var mt time.Time
+	st, err := os.Stat(p)
+	if err == nil {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return c, mt, err
+		}
+		// 文件中出现的字段覆盖默认值，未出现的保持不变
+		if err := yaml.Unmarshal(b, &c); err != nil {
+			return c, mt, fmt.Errorf("parse %s: %w", p, err)
+		}
+		mt = st.ModTime()
+	} else if !os.IsNotExist(err) {
+		return c, mt, err
+	}
+	if err := c.Validate(); err != nil {
+		return c, mt, fmt.Errorf("invalid config %s: %w", p, err)
+	}
+	return c, mt, nil
+}
+
+// Apply 校验并应用配置到各模块；server.port 只在启动时生效。
+// 先校验全部模块并完成需要读取文件的准备工作，全部成功后才依次提交，避免只应用了一部分模块
+func Apply(c Config) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	commitFleet, err := fleet.Prepare(c.Fleet)
+	if err != nil {
+		return fmt.Errorf("fleet: %w", err)
+	}
+	if current.Server.Port != 0 && current.Server.Port != c.Server.Port {
+		fmt.Printf("[WARN] server.port changed to %d, restart required to take effect.\n", c.Server.Port)
+	}
+	if current.Server.Port != 0 && current.Server.TLS != c.Server.TLS {
+		fmt.Println("[WARN] server.tls changed, restart required to take effect.")
+	}
+	// 以下各模块的配置均已校验：auth 只会在修改任何状态之前失败，其余模块不会再返回错误
+	if !agentOnly {
+		if err := auth.SetConfig(c.Auth); err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+	}
+	m := c.Metrics
+	if agentOnly {
+		m.History.Path = ""
+	}
+	if err := metrics.Apply(m); err != nil {
+		return fmt.Errorf("metrics: %w", err)
+	}
+	if !agentOnly {
+		if err := lan.SetConfig(c.LAN); err != nil {
+			return fmt.Errorf("lan: %w", err)
+		}
+	}
+	commitFleet()
+	// 通知配置未变化时不重建渠道，避免丢弃队列中的消息
+	if !agentOnly && (current.Server.Port == 0 || !reflect.DeepEqual(current.Notify, c.Notify)) {
+		if err := notify.Apply(c.Notify); err != nil {
+			return fmt.Errorf("notify: %w", err)
+		}
+	}
+	current = c
+	return nil
+}
+
+// Reload 重新读取配置文件，失败时保留当前配置
+func Reload() error {
+	p := Path()
+	c, mt, err := load(p)
+	if err != nil {
+		return err
+	}
+	if err := Apply(c); err != nil {
+		return err
+	}
+	mu.Lock()
+	modTime = mt
+	mu.Unlock()
+	return nil
+}
+
+// Watch 在后台监听 SIGHUP 与配置文件修改（每 2 秒检查一次修改时间）
+func Watch() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	ticker := time.NewTicker(2 * time.Second)
+	go func() {
+		for {
+			select {
+			case <-hup:
+				reloadLogged("SIGHUP")
+			case <-ticker.C:
+				var mt time.Time
+				if st, err := os.Stat(Path()); err == nil {
+					mt = st.ModTime()
+				}
+				mu.RLock()
+				changed := !mt.Equal(modTime)
+				mu.RUnlock()
+				if changed {
+					reloadLogged("file change")
+				}
+			}
+		}
+	}()
+}
+
+func reloadLogged(reason string) {
+	if err := Reload(); err != nil {
+		fmt.Printf("[ERROR] Config reload (%s) failed, keeping previous config: %v\n", reason, err)
+		// 记录本次修改时间，避免对同一个非法文件反复报错
+		if st, err := os.Stat(Path()); err == nil {
+			mu.Lock()
+			modTime = st.ModTime()
+			mu.Unlock()
+		}
+		return
+	}
+	fmt.Printf("[INFO] Config reloaded (%s) from %s\n", reason, Path())
+}
+
+// applyEnv 读取旧版环境变量，作为配置文件缺省时的取值
+func applyEnv(c *Config) {
+	if v := os.Getenv("PORT"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			c.Server.Port = n
+		} else {
+			fmt.Printf("[WARN] Invalid PORT=%q: %v\n", v, err)
+		}
+	}
+	m := &c.Metrics
+	m.GeoIPPath = os.Getenv("GEOIP_DB_PATH")
+	envFloat("ALERT_CPU_WARN", &m.CPUWarn)
+	envFloat("ALERT_MEM_WARN", &m.MemWarn)
+	if v, ok := os.LookupEnv("HISTORY_DB_PATH"); ok {
+		m.History.Path = v
+	}
+	envDuration("HISTORY_RETENTION_RAW", &m.History.RawRetention)
+	envDuration("HISTORY_RETENTION_1M", &m.History.Retention1m)
+	envDuration("HISTORY_RETENTION_5M", &m.History.Retention5m)
+	envDuration("HISTORY_RETENTION_1H", &m.History.Retention1h)
+	m.Host = metrics.HostConfig{
+		Proc:     os.Getenv("HOST_PROC"),
+		Sys:      os.Getenv("HOST_SYS"),
+		Etc:      os.Getenv("HOST_ETC"),
+		Root:     os.Getenv("HOST_ROOT"),
+		Hostname: os.Getenv("HOST_HOSTNAME"),
+		OS:       os.Getenv("HOST_OS"),
+	}
+	// 批量部署 agent 时通常只需设置这几项
+	a := &c.Fleet.Agent
+	a.Server = os.Getenv("AGENT_SERVER")
+	a.Token = os.Getenv("AGENT_TOKEN")
+	a.Host = os.Getenv("AGENT_HOST")
+	a.CertFile = os.Getenv("AGENT_CERT_FILE")
+	a.KeyFile = os.Getenv("AGENT_KEY_FILE")
+	a.CAFile = os.Getenv("AGENT_CA_FILE")
+	envDuration("AGENT_INTERVAL", &a.Interval)
+}
+
+func envFloat(name string, dst *float64) {
+	if v := os.Getenv(name); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			*dst = f
+		} else {
+			fmt.Printf("[WARN] Invalid %s=%q: %v\n", name, v, err)
+		}
+	}
+}
+
+func envDuration(name string, dst *time.Duration) {
+	if v := os.Getenv(name); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			*dst = d
+		} else {
+			fmt.Printf("[WARN] Invalid %s=%q: %v\n", name, v, err)
+		}
+	}
+}
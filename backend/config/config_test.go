@@ -0,0 +1,57 @@
+package config
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"system-monitor/fleet"
+	"system-monitor/metrics"
+)
+
+// testConfig 返回可以直接 Apply 的默认配置，Token 与历史文件放在临时目录
+func testConfig(t *testing.T) Config {
+	t.Helper()
+	c := Default()
+	c.Auth.TokensPath = filepath.Join(t.TempDir(), "tokens.json")
+	c.Metrics.History.Path = ""
+	return c
+}
+
+func TestApplyAllOrNothing(t *testing.T) {
+	c := testConfig(t)
+	c.Metrics.NetLogCap = 123
+	if err := Apply(c); err != nil {
+		t.Fatal(err)
+	}
+
+	// fleet 的 CA 文件读取失败：校验通过，但准备阶段失败，其余模块也不能被修改
+	next := c
+	next.Metrics.NetLogCap = 456
+	next.Fleet.Agent = fleet.DefaultConfig().Agent
+	next.Fleet.Agent.Server = "https://monitor.example.com"
+	next.Fleet.Agent.Token = "smt_x"
+	next.Fleet.Agent.CAFile = filepath.Join(t.TempDir(), "missing.pem")
+	err := Apply(next)
+	if err == nil || !strings.Contains(err.Error(), "fleet: agent.ca_file") {
+		t.Fatalf("err = %v, want fleet ca_file error", err)
+	}
+	if got := metrics.GetConfig().NetLogCap; got != 123 {
+		t.Errorf("metrics applied despite error: netlog_cap = %d", got)
+	}
+	if !reflect.DeepEqual(Current(), c) {
+		t.Error("current config changed despite error")
+	}
+	if fleet.AgentEnabled() {
+		t.Error("agent started despite error")
+	}
+
+	// 校验失败同样不修改任何模块
+	next = c
+	next.Metrics.NetLogCap = 456
+	next.Server.Port = 0
+	if err := Apply(next); err == nil || metrics.GetConfig().NetLogCap != 123 {
+		t.Errorf("invalid config: err = %v, netlog_cap = %d", err, metrics.GetConfig().NetLogCap)
+	}
+}
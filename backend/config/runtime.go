@@ -0,0 +1,292 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"system-monitor/lan"
+	"system-monitor/metrics"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+)
+
+// Runtime 是允许通过 /api/config 在运行中修改的配置子集；
+// server 与 notify（含密码等敏感信息）只能通过配置文件修改。
+type Runtime struct {
+	Metrics metrics.Config `yaml:"metrics"`
+	LAN     lan.Config     `yaml:"lan"`
+}
+
+// updateMu 串行化 读取-修改-写回 流程，避免并发 PUT 互相覆盖
+var updateMu sync.Mutex
+
+// redacted 在 GET /api/config 中代替已设置的密钥；PUT 时原样传回表示保持原值
+const redacted = "******"
+
+// runtimeSecrets 是运行时配置中的密钥字段
+var runtimeSecrets = [][]string{
+	{"lan", "federation", "token"},
+}
+
+// RuntimeJSON 以 JSON 返回当前运行时配置，字段名与配置文件一致，时长格式为 "30s"，密钥以占位符代替
+func RuntimeJSON() ([]byte, error) {
+	c := Current()
+	b, err := yaml.Marshal(Runtime{Metrics: c.Metrics, LAN: c.LAN})
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.MapSlice
+	if err := yaml.UnmarshalWithOptions(b, &doc, yaml.UseOrderedMap()); err != nil {
+		return nil, err
+	}
+	for _, path := range runtimeSecrets {
+		redactPath(doc, path)
+	}
+	if b, err = yaml.Marshal(doc); err != nil {
+		return nil, err
+	}
+	js, err := yaml.YAMLToJSON(b)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := json.Compact(&out, js); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// redactPath 把 path 处非空的字符串替换为占位符
+func redactPath(doc yaml.MapSlice, path []string) {
+	for i := range doc {
+		if k, ok := doc[i].Key.(string); !ok || k != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			if v, ok := doc[i].Value.(string); ok && v != "" {
+				doc[i].Value = redacted
+			}
+		} else if sub, ok := doc[i].Value.(yaml.MapSlice); ok {
+			redactPath(sub, path[1:])
+		}
+		return
+	}
+}
+
+// UpdateRuntime 把 body（JSON 或 YAML，可只包含部分字段）合并到当前配置，
+// 校验通过后立即生效，并只把 body 中出现的字段写回配置文件。未知字段视为错误。
+func UpdateRuntime(body []byte) error {
+	updateMu.Lock()
+	defer updateMu.Unlock()
+
+	var patch map[string]interface{}
+	if err := yaml.Unmarshal(body, &patch); err != nil {
+		return &ValidationError{Err: err}
+	}
+	// 传回的占位符表示不修改该密钥
+	for _, path := range runtimeSecrets {
+		if v, ok := lookupPath(patch, path); ok && v == redacted {
+			deletePath(patch, path)
+		}
+	}
+	clean, err := yaml.Marshal(patch)
+	if err != nil {
+		return &ValidationError{Err: err}
+	}
+
+	c := Current()
+	rt := Runtime{Metrics: c.Metrics, LAN: c.LAN}
+	if err := yaml.UnmarshalWithOptions(clean, &rt, yaml.DisallowUnknownField()); err != nil {
+		return &ValidationError{Err: err}
+	}
+	c.Metrics, c.LAN = rt.Metrics, rt.LAN
+	if err := c.Validate(); err != nil {
+		return &ValidationError{Err: err}
+	}
+	if err := Apply(c); err != nil {
+		return err
+	}
+	return save(patch)
+}
+
+func lookupPath(m map[string]interface{}, path []string) (interface{}, bool) {
+	v, ok := m[path[0]]
+	if !ok || len(path) == 1 {
+		return v, ok
+	}
+	sub, isMap := v.(map[string]interface{})
+	if !isMap {
+		return nil, false
+	}
+	return lookupPath(sub, path[1:])
+}
+
+func deletePath(m map[string]interface{}, path []string) {
+	if len(path) == 1 {
+		delete(m, path[0])
+		return
+	}
+	if sub, ok := m[path[0]].(map[string]interface{}); ok {
+		deletePath(sub, path[1:])
+		// 删除后为空的父节点一并去掉，避免写回 "federation: {}"
+		if len(sub) == 0 {
+			delete(m, path[0])
+		}
+	}
+}
+
+// ValidationError 表示请求内容非法，对应 HTTP 400
+type ValidationError struct {
+	Err error
+}
+
+func (e *ValidationError) Error() string { return e.Err.Error() }
+
+func (e *ValidationError) Unwrap() error { return e.Err }
+
+// save 把 patch 中出现的字段写入配置文件，文件中的其余内容（包括注释、来自环境变量而未写入文件的设置）保持原样。
+// 先写临时文件再改名保证原子性，并记录修改时间避免被监听协程重复加载。
+func save(patch map[string]interface{}) error {
+	p := Path()
+	src, err := os.ReadFile(p)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("save config: %w", err)
+	}
+	b, err := mergeYAML(src, patch)
+	if err != nil {
+		return fmt.Errorf("save config: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".config-*.yaml")
+	if err != nil {
+		return fmt.Errorf("save config: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return fmt.Errorf("save config: %w", err)
+	}
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("save config: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("save config: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return fmt.Errorf("save config: %w", err)
+	}
+	if st, err := os.Stat(p); err == nil {
+		mu.Lock()
+		modTime = st.ModTime()
+		mu.Unlock()
+	}
+	return nil
+}
+
+// mergeYAML 把 patch 的每个叶子值（标量或列表）写入 src 中对应的位置，缺少的键追加到最近的已有父节点下
+func mergeYAML(src []byte, patch map[string]interface{}) ([]byte, error) {
+	f, err := parser.ParseBytes(src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	if len(f.Docs) == 0 || f.Docs[0].Body == nil || f.Docs[0].Body.Type() == ast.CommentType {
+		// 空文件（或只有注释）：直接追加
+		b, err := yaml.Marshal(patch)
+		if err != nil {
+			return nil, err
+		}
+		if len(bytes.TrimSpace(src)) == 0 {
+			return b, nil
+		}
+		return append(append(bytes.TrimRight(src, "\n"), '\n'), b...), nil
+	}
+	for _, leaf := range flattenPatch(nil, patch) {
+		if err := setPath(f, leaf.path, leaf.value); err != nil {
+			return nil, err
+		}
+	}
+	out := []byte(f.String())
+	var check map[string]interface{}
+	if err := yaml.Unmarshal(out, &check); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+type patchLeaf struct {
+	path  []string
+	value interface{}
+}
+
+// flattenPatch 按键名排序展开嵌套的 map，保证写入顺序稳定
+func flattenPatch(prefix []string, m map[string]interface{}) []patchLeaf {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var out []patchLeaf
+	for _, k := range keys {
+		path := append(append([]string(nil), prefix...), k)
+		if sub, ok := m[k].(map[string]interface{}); ok && len(sub) > 0 {
+			out = append(out, flattenPatch(path, sub)...)
+			continue
+		}
+		out = append(out, patchLeaf{path: path, value: m[k]})
+	}
+	return out
+}
+
+func buildPath(keys []string) *yaml.Path {
+	b := (&yaml.PathBuilder{}).Root()
+	for _, k := range keys {
+		b = b.Child(k)
+	}
+	return b.Build()
+}
+
+// setPath 替换已有的值；路径不存在时把剩余部分作为嵌套 map 合并到最近的已有父节点
+func setPath(f *ast.File, path []string, value interface{}) error {
+	i := len(path)
+	for ; i > 0; i-- {
+		if node, err := buildPath(path[:i]).FilterFile(f); err == nil && node != nil {
+			break
+		}
+	}
+	if i == len(path) {
+		b, err := yaml.Marshal(value)
+		if err != nil {
+			return err
+		}
+		// 替换会丢掉原值的行尾注释，替换后重新挂上
+		old, _ := buildPath(path).FilterFile(f)
+		comment := old.GetComment()
+		if err := buildPath(path).ReplaceWithReader(f, bytes.NewReader(b)); err != nil {
+			return err
+		}
+		if comment == nil {
+			return nil
+		}
+		node, err := buildPath(path).FilterFile(f)
+		if err != nil {
+			return err
+		}
+		return node.SetComment(comment)
+	}
+	var nested interface{} = value
+	for j := len(path) - 1; j >= i; j-- {
+		nested = yaml.MapSlice{{Key: path[j], Value: nested}}
+	}
+	b, err := yaml.Marshal(nested)
+	if err != nil {
+		return err
+	}
+	return buildPath(path[:i]).MergeFromReader(f, bytes.NewReader(b))
+}
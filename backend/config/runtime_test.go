@@ -0,0 +1,159 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"system-monitor/metrics"
+)
+
+// usePath 把配置文件路径指向 p，测试结束后恢复
+func usePath(t *testing.T, p string) {
+	t.Helper()
+	mu.Lock()
+	prev := path
+	path = p
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		path = prev
+		mu.Unlock()
+	})
+}
+
+func TestRuntimeJSONRedaction(t *testing.T) {
+	tests := []struct {
+		token string
+		want  string
+	}{
+		{"smt_secret", `"token":"******"`},
+		{"", `"token":""`}, // 未设置时不显示占位符，前端据此区分
+	}
+	for _, tt := range tests {
+		c := testConfig(t)
+		c.LAN.Federation.Token = tt.token
+		if err := Apply(c); err != nil {
+			t.Fatal(err)
+		}
+		b, err := RuntimeJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(b), tt.want) || (tt.token != "" && strings.Contains(string(b), tt.token)) {
+			t.Errorf("token %q: %s", tt.token, b)
+		}
+		var rt map[string]map[string]interface{}
+		if err := json.Unmarshal(b, &rt); err != nil {
+			t.Fatal(err)
+		}
+		if rt["metrics"]["interval"] != "1s" {
+			t.Errorf("interval = %v, want duration string", rt["metrics"]["interval"])
+		}
+		if _, ok := rt["server"]; ok {
+			t.Error("server section exposed")
+		}
+	}
+}
+
+func TestUpdateRuntime(t *testing.T) {
+	c := testConfig(t)
+	c.LAN.Federation.Token = "smt_secret"
+	if err := Apply(c); err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(t.TempDir(), "config.yaml")
+	src := "# 本机配置\nserver:\n  port: 9090 # 管理端口\nmetrics:\n  netlog_cap: 100\n"
+	if err := os.WriteFile(p, []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	usePath(t, p)
+
+	// 传回占位符保持原密钥，只有出现的字段写回文件
+	body := `{"metrics":{"netlog_cap":200,"interval":"5s"},"lan":{"federation":{"token":"******"}}}`
+	if err := UpdateRuntime([]byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	cur := Current()
+	if cur.Metrics.NetLogCap != 200 || metrics.GetConfig().NetLogCap != 200 || cur.LAN.Federation.Token != "smt_secret" {
+		t.Errorf("netlog_cap = %d, token = %q", cur.Metrics.NetLogCap, cur.LAN.Federation.Token)
+	}
+	b, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"# 本机配置", "port: 9090 # 管理端口", "netlog_cap: 200", "interval: 5s"} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("file lost %q:\n%s", want, b)
+		}
+	}
+	if strings.Contains(string(b), "token") || strings.Contains(string(b), "lan:") {
+		t.Errorf("untouched fields written:\n%s", b)
+	}
+	if st, _ := os.Stat(p); st.Mode().Perm() != 0o600 {
+		t.Errorf("mode = %v", st.Mode().Perm())
+	}
+
+	for _, bad := range []string{`{"metrics":{"netlog_cpa":1}}`, `{"metrics":{"netlog_cap":-1}}`, `{"server":{"port":1}}`, `{`} {
+		var ve *ValidationError
+		if err := UpdateRuntime([]byte(bad)); !errors.As(err, &ve) {
+			t.Errorf("UpdateRuntime(%s) = %v, want ValidationError", bad, err)
+		}
+	}
+	if Current().Metrics.NetLogCap != 200 {
+		t.Error("rejected update applied")
+	}
+}
+
+func TestMergeYAML(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		patch map[string]interface{}
+		want  []string
+	}{
+		{
+			"replace existing value",
+			"metrics:\n  cpu_warn: 80 # 百分比\n",
+			map[string]interface{}{"metrics": map[string]interface{}{"cpu_warn": 90}},
+			[]string{"cpu_warn: 90", "# 百分比"},
+		},
+		{
+			"append under nearest parent",
+			"metrics:\n  cpu_warn: 80\nserver:\n  port: 8080\n",
+			map[string]interface{}{"metrics": map[string]interface{}{"history": map[string]interface{}{"retention": "24h"}}},
+			[]string{"cpu_warn: 80", "retention: 24h", "port: 8080"},
+		},
+		{
+			"replace list",
+			"lan:\n  federation:\n    peers:\n    - 10.0.0.2\n",
+			map[string]interface{}{"lan": map[string]interface{}{"federation": map[string]interface{}{"peers": []interface{}{"10.0.0.3"}}}},
+			[]string{"10.0.0.3"},
+		},
+		{
+			"comment-only file",
+			"# 空配置\n",
+			map[string]interface{}{"metrics": map[string]interface{}{"netlog_cap": 50}},
+			[]string{"# 空配置", "netlog_cap: 50"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := mergeYAML([]byte(tt.src), tt.patch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(string(b), want) {
+					t.Errorf("missing %q in:\n%s", want, b)
+				}
+			}
+			if strings.Contains(string(b), "10.0.0.2") {
+				t.Errorf("old list kept:\n%s", b)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package fleet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"system-monitor/metrics"
+)
+
+// Report 是 agent 每次推送的内容
+type Report struct {
+	Host string                `json:"host"`
+	Data metrics.DashboardData `json:"data"`
+}
+
+type pusher struct {
+	cfg    AgentConfig
+	url    string
+	client *http.Client
+	queue  chan []byte // 只保留最新一份待发送数据
+	done   chan struct{}
+
+	lastQueued time.Time // 只在采集协程中访问
+	failing    bool
+}
+
+var (
+	agentMu sync.Mutex
+	agent   *pusher
+)
+
+// Init 订阅采集数据并注册指标，需在采集开始前调用；推送由 Apply 按配置启动
+func Init() {
+	metrics.OnCollect(onCollect)
+	metrics.RegisterGauge("fleet_hosts_online", "Number of agents that reported within server.stale_after.", func() float64 {
+		return float64(onlineCount())
+	})
+}
+
+func onCollect(d metrics.DashboardData) {
+	agentMu.Lock()
+	p := agent
+	agentMu.Unlock()
+	if p != nil {
+		p.enqueue(d)
+	}
+}
+
+// replaceAgent 停止当前推送协程并启动 next（为 nil 时不再推送）
+func replaceAgent(next *pusher) {
+	agentMu.Lock()
+	prev := agent
+	agent = next
+	agentMu.Unlock()
+	if prev != nil {
+		close(prev.done)
+	}
+	if next != nil {
+		go next.run()
+		fmt.Printf("[INFO] Agent pushing to %s every %s\n", next.url, next.cfg.Interval)
+	}
+}
+
+func newPusher(c AgentConfig) (*pusher, error) {
+	tlsCfg := &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("agent.ca_file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("agent.ca_file: no certificates found in %s", c.CAFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("agent.cert_file: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.TLSClientConfig = tlsCfg
+	return &pusher{
+		cfg:    c,
+		url:    strings.TrimRight(c.Server, "/") + "/api/agent/push",
+		client: &http.Client{Transport: tr},
+		queue:  make(chan []byte, 1),
+		done:   make(chan struct{}),
+	}, nil
+}
+
+// enqueue 在采集协程中执行：按推送间隔序列化数据，未发出的旧数据直接替换
+func (p *pusher) enqueue(d metrics.DashboardData) {
+	now := time.Now()
+	// 容忍采集周期的抖动，避免间隔与采集周期相同时隔一次才推送
+	if now.Sub(p.lastQueued) < p.cfg.Interval*9/10 {
+		return
+	}
+	p.lastQueued = now
+	host := p.cfg.Host
+	if host == "" {
+		host = d.System.Hostname
+	}
+	b, err := json.Marshal(Report{Host: host, Data: d})
+	if err != nil {
+		fmt.Printf("[ERROR] Agent marshal report: %v\n", err)
+		return
+	}
+	select {
+	case <-p.queue:
+	default:
+	}
+	p.queue <- b
+}
+
+func (p *pusher) run() {
+	for {
+		select {
+		case <-p.done:
+			return
+		case b := <-p.queue:
+			err := p.push(b)
+			// 只在状态变化时输出日志，避免中心服务不可用时刷屏
+			if err != nil && !p.failing {
+				fmt.Printf("[WARN] Agent push to %s failed: %v\n", p.url, err)
+			} else if err == nil && p.failing {
+				fmt.Printf("[INFO] Agent push to %s recovered\n", p.url)
+			}
+			p.failing = err != nil
+		}
+	}
+}
+
+func (p *pusher) push(b []byte) error {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(b)
+	zw.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.cfg.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	// 只配置了客户端证书时由中心服务按证书 CN 认证
+	if p.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.cfg.Token)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package fleet
+
+import (
+	"errors"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// 多主机监控：agent 定期把本机的 DashboardData 推送到中心服务，中心服务按主机保存最新数据。
+// 同一个程序既可以作为 agent（配置 agent.server），也可以作为中心服务（server.enabled），两者可同时开启。
+
+type Config struct {
+	Agent  AgentConfig  `yaml:"agent"`
+	Server ServerConfig `yaml:"server"`
+}
+
+type AgentConfig struct {
+	Server             string        `yaml:"server"`               // 中心服务地址，如 https://monitor.example.com:8080，为空时不推送
+	Token              string        `yaml:"token"`                // 中心服务签发的 API Token（operator 及以上），使用客户端证书时可省略
+	Host               string        `yaml:"host"`                 // 上报的主机名，默认使用采集到的主机名
+	Interval           time.Duration `yaml:"interval"`             // 推送间隔，默认 5s
+	Timeout            time.Duration `yaml:"timeout"`              // 单次推送超时，默认 10s
+	CertFile           string        `yaml:"cert_file"`            // 客户端证书，中心服务开启 mTLS（tls.client_ca_file）时使用
+	KeyFile            string        `yaml:"key_file"`             // 客户端证书私钥
+	CAFile             string        `yaml:"ca_file"`              // 校验中心服务证书的 CA（自签名证书时使用）
+	InsecureSkipVerify bool          `yaml:"insecure_skip_verify"` // 不校验中心服务证书，仅用于测试
+}
+
+type ServerConfig struct {
+	Enabled    bool          `yaml:"enabled"`     // 接收 agent 推送
+	StaleAfter time.Duration `yaml:"stale_after"` // 超过该时长未收到推送视为离线，默认 30s
+	Expire     time.Duration `yaml:"expire"`      // 离线超过该时长后从主机列表移除，0 表示一直保留
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Agent:  AgentConfig{Interval: 5 * time.Second, Timeout: 10 * time.Second},
+		Server: ServerConfig{StaleAfter: 30 * time.Second},
+	}
+}
+
+func (c Config) Validate() error {
+	if a := c.Agent; a.Server != "" {
+		u, err := url.Parse(a.Server)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("agent.server must be an http(s) URL")
+		}
+		if (a.CertFile == "") != (a.KeyFile == "") {
+			return errors.New("agent.cert_file and agent.key_file must be set together")
+		}
+		if a.CertFile != "" && u.Scheme != "https" {
+			return errors.New("agent.cert_file requires an https agent.server")
+		}
+		if a.Token == "" && a.CertFile == "" {
+			return errors.New("agent.token or agent.cert_file is required when agent.server is set")
+		}
+		if a.Interval < time.Second {
+			return errors.New("agent.interval must be at least 1s")
+		}
+		if a.Timeout <= 0 {
+			return errors.New("agent.timeout must be positive")
+		}
+	}
+	if c.Server.StaleAfter <= 0 {
+		return errors.New("server.stale_after must be positive")
+	}
+	if c.Server.Expire < 0 {
+		return errors.New("server.expire must not be negative")
+	}
+	return nil
+}
+
+var (
+	cfgMu sync.RWMutex
+	cfg   = DefaultConfig()
+)
+
+// Prepare 校验配置，agent 配置变化时预先读取证书并创建新的推送协程（尚未启动）。
+// 返回的 commit 应用配置且不会失败；不调用 commit 时当前配置不受影响
+func Prepare(c Config) (commit func(), err error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	restart := c.Agent != currentConfig().Agent
+	var next *pusher
+	if restart && c.Agent.Server != "" {
+		if next, err = newPusher(c.Agent); err != nil {
+			return nil, err
+		}
+	}
+	return func() {
+		cfgMu.Lock()
+		defer cfgMu.Unlock()
+		if restart {
+			replaceAgent(next)
+		}
+		cfg = c
+	}, nil
+}
+
+// Apply 应用配置：agent 配置变化时重启推送协程，server 配置立即生效
+func Apply(c Config) error {
+	commit, err := Prepare(c)
+	if err != nil {
+		return err
+	}
+	commit()
+	return nil
+}
+
+func currentConfig() Config {
+	cfgMu.RLock()
+	defer cfgMu.RUnlock()
+	return cfg
+}
+
+// ServerEnabled 返回是否接收 agent 推送
+func ServerEnabled() bool {
+	return currentConfig().Server.Enabled
+}
+
+// AgentEnabled 返回是否配置了中心服务地址
+func AgentEnabled() bool {
+	return currentConfig().Agent.Server != ""
+}
@@ -0,0 +1,141 @@
+package fleet
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"system-monitor/metrics"
+)
+
+const maxReportSize = 8 << 20 // 解压后的单次推送上限
+
+// Host 是主机列表中的一项，本机始终排在第一位
+type Host struct {
+	Name     string  `json:"name"`
+	Local    bool    `json:"local"`
+	Online   bool    `json:"online"`
+	Addr     string  `json:"addr,omitempty"` // 最近一次推送的来源地址
+	LastSeen int64   `json:"last_seen"`
+	OS       string  `json:"os"`
+	Platform string  `json:"platform"`
+	CPU      float64 `json:"cpu"`
+	Memory   float64 `json:"memory"`
+	Alerts   int     `json:"alerts"` // 尚未恢复的告警数
+}
+
+type hostState struct {
+	data     metrics.DashboardData
+	addr     string
+	lastSeen time.Time
+}
+
+var (
+	storeMu sync.RWMutex
+	hosts   = make(map[string]*hostState)
+)
+
+// ReadReport 解析 agent 推送的请求体，支持 gzip 压缩
+func ReadReport(r *http.Request) (Report, error) {
+	var rep Report
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return rep, err
+		}
+		defer zr.Close()
+		body = zr
+	}
+	body = io.LimitReader(body, maxReportSize+1)
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return rep, err
+	}
+	if len(b) > maxReportSize {
+		return rep, fmt.Errorf("report exceeds %d bytes", maxReportSize)
+	}
+	if err := json.Unmarshal(b, &rep); err != nil {
+		return rep, err
+	}
+	if rep.Host == "" || len(rep.Host) > 253 {
+		return rep, errors.New("host must be 1-253 characters")
+	}
+	return rep, nil
+}
+
+// Receive 保存 agent 推送的最新数据
+func Receive(rep Report, addr string) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	hosts[rep.Host] = &hostState{data: rep.Data, addr: addr, lastSeen: time.Now()}
+}
+
+// Dashboard 返回某台 agent 最近一次推送的数据
+func Dashboard(host string) (metrics.DashboardData, bool) {
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	st, ok := hosts[host]
+	if !ok {
+		return metrics.DashboardData{}, false
+	}
+	return st.data, true
+}
+
+// Hosts 返回本机与全部 agent 的概况，同时清理离线超过 server.expire 的主机
+func Hosts() []Host {
+	sc := currentConfig().Server
+	metrics.Mu.RLock()
+	local := summary(metrics.Latest)
+	metrics.Mu.RUnlock()
+	local.Local, local.Online, local.LastSeen = true, true, time.Now().Unix()
+
+	list := []Host{local}
+	storeMu.Lock()
+	for name, st := range hosts {
+		age := time.Since(st.lastSeen)
+		if sc.Expire > 0 && age > sc.Expire {
+			delete(hosts, name)
+			continue
+		}
+		h := summary(st.data)
+		h.Name = name
+		h.Addr = st.addr
+		h.LastSeen = st.lastSeen.Unix()
+		h.Online = age <= sc.StaleAfter
+		list = append(list, h)
+	}
+	storeMu.Unlock()
+	sort.Slice(list[1:], func(i, j int) bool { return list[i+1].Name < list[j+1].Name })
+	return list
+}
+
+func summary(d metrics.DashboardData) Host {
+	return Host{
+		Name:     d.System.Hostname,
+		OS:       d.System.OS,
+		Platform: d.System.Platform,
+		CPU:      d.CPU.Usage,
+		Memory:   d.Memory.UsedPercent,
+		Alerts:   len(d.Current),
+	}
+}
+
+func onlineCount() int {
+	stale := currentConfig().Server.StaleAfter
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	n := 0
+	for _, st := range hosts {
+		if time.Since(st.lastSeen) <= stale {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,250 @@
+package fleet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"system-monitor/metrics"
+)
+
+// resetFleet 清空主机列表并应用给定的 server 配置，测试结束后恢复
+func resetFleet(t *testing.T, sc ServerConfig) {
+	t.Helper()
+	cfgMu.Lock()
+	prev := cfg
+	cfg.Server = sc
+	cfgMu.Unlock()
+	storeMu.Lock()
+	hosts = make(map[string]*hostState)
+	storeMu.Unlock()
+	t.Cleanup(func() {
+		cfgMu.Lock()
+		cfg = prev
+		cfgMu.Unlock()
+		storeMu.Lock()
+		hosts = make(map[string]*hostState)
+		storeMu.Unlock()
+	})
+}
+
+func gzipped(t *testing.T, b []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(b)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadReport(t *testing.T) {
+	valid, _ := json.Marshal(Report{Host: "web-01", Data: metrics.DashboardData{System: metrics.SystemInfo{OS: "linux"}}})
+	tests := []struct {
+		name    string
+		body    []byte
+		gzip    bool
+		wantErr string
+	}{
+		{"plain json", valid, false, ""},
+		{"gzip json", valid, true, ""},
+		{"gzip header on plain body", valid, false, "gzip"},
+		{"invalid json", []byte(`{"host":`), false, "unexpected end"},
+		{"missing host", []byte(`{"data":{}}`), false, "host must be"},
+		{"host too long", []byte(`{"host":"` + strings.Repeat("a", 254) + `"}`), false, "host must be"},
+		{"too large", append(append([]byte(`{"host":"x","pad":"`), bytes.Repeat([]byte("a"), maxReportSize)...), `"}`...), true, "exceeds"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := tt.body
+			if tt.gzip {
+				body = gzipped(t, body)
+			}
+			r := httptest.NewRequest(http.MethodPost, "/api/agent/push", bytes.NewReader(body))
+			if tt.gzip || tt.name == "gzip header on plain body" {
+				r.Header.Set("Content-Encoding", "gzip")
+			}
+			rep, err := ReadReport(r)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if rep.Host != "web-01" || rep.Data.System.OS != "linux" {
+					t.Errorf("report = %+v", rep)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// pushServer 模拟中心服务的 /api/agent/push：校验 Token 后读取并保存推送
+func pushServer(t *testing.T, token string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/agent/push" || r.Method != http.MethodPost {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		rep, err := ReadReport(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		Receive(rep, "10.0.0.2")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestAgentPush(t *testing.T) {
+	resetFleet(t, ServerConfig{Enabled: true, StaleAfter: 30 * time.Second})
+	srv := pushServer(t, "smt_secret")
+	data := metrics.DashboardData{
+		System:  metrics.SystemInfo{Hostname: "collected-name", OS: "linux", Platform: "debian"},
+		CPU:     metrics.CPUInfo{Usage: 12.5},
+		Memory:  metrics.MemoryInfo{UsedPercent: 40},
+		Current: []metrics.AlertInfo{{ID: "a1"}},
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		host     string
+		wantErr  string
+		wantHost string
+	}{
+		{"wrong token", "smt_wrong", "", "status 401", ""},
+		{"collected hostname", "smt_secret", "", "", "collected-name"},
+		{"configured host", "smt_secret", "web-01", "", "web-01"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := newPusher(AgentConfig{Server: srv.URL + "/", Token: tt.token, Host: tt.host, Interval: time.Second, Timeout: time.Second})
+			if err != nil {
+				t.Fatal(err)
+			}
+			p.enqueue(data)
+			err = p.push(<-p.queue)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := Dashboard(tt.wantHost)
+			if !ok || got.CPU.Usage != 12.5 || len(got.Current) != 1 {
+				t.Errorf("Dashboard(%s) = %+v, %v", tt.wantHost, got, ok)
+			}
+		})
+	}
+
+	list := Hosts()
+	if len(list) != 3 || !list[0].Local {
+		t.Fatalf("Hosts = %+v", list)
+	}
+	h := list[1]
+	if h.Name != "collected-name" || !h.Online || h.Addr != "10.0.0.2" || h.CPU != 12.5 || h.Memory != 40 || h.Alerts != 1 || h.Platform != "debian" {
+		t.Errorf("host = %+v", h)
+	}
+	if list[2].Name != "web-01" {
+		t.Errorf("hosts not sorted: %+v", list)
+	}
+}
+
+func TestAgentEnqueueInterval(t *testing.T) {
+	p := &pusher{cfg: AgentConfig{Interval: time.Hour}, queue: make(chan []byte, 1)}
+	p.enqueue(metrics.DashboardData{System: metrics.SystemInfo{Hostname: "first"}})
+	p.enqueue(metrics.DashboardData{System: metrics.SystemInfo{Hostname: "second"}})
+	var rep Report
+	if err := json.Unmarshal(<-p.queue, &rep); err != nil || rep.Host != "first" {
+		t.Errorf("queued %+v, %v", rep, err)
+	}
+	select {
+	case b := <-p.queue:
+		t.Errorf("enqueued within interval: %s", b)
+	default:
+	}
+}
+
+func TestHostsStaleAndExpire(t *testing.T) {
+	resetFleet(t, ServerConfig{Enabled: true, StaleAfter: time.Minute, Expire: time.Hour})
+	now := time.Now()
+	storeMu.Lock()
+	hosts["fresh"] = &hostState{lastSeen: now}
+	hosts["stale"] = &hostState{lastSeen: now.Add(-10 * time.Minute)}
+	hosts["expired"] = &hostState{lastSeen: now.Add(-2 * time.Hour)}
+	storeMu.Unlock()
+
+	online := map[string]bool{}
+	for _, h := range Hosts()[1:] {
+		online[h.Name] = h.Online
+	}
+	want := map[string]bool{"fresh": true, "stale": false}
+	if len(online) != len(want) || online["fresh"] != true || online["stale"] != false {
+		t.Errorf("hosts = %v, want %v", online, want)
+	}
+	if _, ok := Dashboard("expired"); ok {
+		t.Error("expired host not removed")
+	}
+	if n := onlineCount(); n != 1 {
+		t.Errorf("onlineCount = %d, want 1", n)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	agent := func(mutate func(*AgentConfig)) Config {
+		c := DefaultConfig()
+		c.Agent.Server = "https://monitor.example.com:8080"
+		c.Agent.Token = "smt_x"
+		mutate(&c.Agent)
+		return c
+	}
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr string
+	}{
+		{"default", DefaultConfig(), ""},
+		{"token", agent(func(a *AgentConfig) {}), ""},
+		{"client cert without token", agent(func(a *AgentConfig) { a.Token, a.CertFile, a.KeyFile = "", "agent.crt", "agent.key" }), ""},
+		{"no credentials", agent(func(a *AgentConfig) { a.Token = "" }), "agent.token or agent.cert_file"},
+		{"cert without key", agent(func(a *AgentConfig) { a.CertFile = "agent.crt" }), "set together"},
+		{"cert over http", agent(func(a *AgentConfig) {
+			a.Server, a.CertFile, a.KeyFile = "http://10.0.0.1:8080", "agent.crt", "agent.key"
+		}), "https"},
+		{"bad url", agent(func(a *AgentConfig) { a.Server = "monitor:8080" }), "http(s) URL"},
+		{"short interval", agent(func(a *AgentConfig) { a.Interval = 100 * time.Millisecond }), "interval"},
+		{"stale_after", Config{Server: ServerConfig{}}, "stale_after"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
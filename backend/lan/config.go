@@ -0,0 +1,175 @@
+package lan
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	MonitorPort int           `yaml:"monitor_port"` // 探测对端是否部署了监控前端的端口
+	Targets     []Target      `yaml:"targets"`      // 扫描目标，为空时扫描第一个非回环网卡所在的网段
+	Exclude     []string      `yaml:"exclude"`      // 所有目标都不扫描的地址或网段
+	MinPrefix   int           `yaml:"min_prefix"`   // 网卡掩码短于该长度时收窄为该长度；更大的 cidr 目标需设置 allow_large
+	MaxHosts    int           `yaml:"max_hosts"`    // 单个目标的最大地址数，超过时报错而不截断（allow_large 的目标不受限）
+	Concurrency int           `yaml:"concurrency"`  // 并发探测数
+	CacheTTL    time.Duration `yaml:"cache_ttl"`    // 扫描结果缓存时长
+	Ping        PingConfig    `yaml:"ping"`
+	ARPSolicit  bool          `yaml:"arp_solicit"` // 主动触发 ARP 解析，发现不响应 ping 的主机
+	ARPTimeout  time.Duration `yaml:"arp_timeout"` // 从触发 ARP 起等待邻居表确认的最长时间
+	Demo        bool          `yaml:"demo"`        // 在扫描结果中追加演示用的虚拟设备，仅用于展示
+
+	OUIPath            string        `yaml:"oui_path"`            // 外部 OUI 表（IEEE oui.txt / oui.csv），覆盖内置的常见厂商表
+	InventoryPath      string        `yaml:"inventory_path"`      // 设备清单文件，为空时只保存在内存中
+	InventoryRetention time.Duration `yaml:"inventory_retention"` // 超过该时长未出现的设备从清单移除，0 表示一直保留
+
+	Services   ServicesConfig   `yaml:"services"`   // 对发现的主机进行服务探测
+	Federation FederationConfig `yaml:"federation"` // 拉取已部署监控的对端状态
+}
+
+// PingConfig 是扫描时对每个地址的 ICMP echo 参数
+type PingConfig struct {
+	Count   int           `yaml:"count"`   // 每个在线主机发送的 echo 数，首个请求超时即视为不在线，默认 3
+	Timeout time.Duration `yaml:"timeout"` // 单个 echo 的等待时间，默认 1s
+	Size    int           `yaml:"size"`    // 负载字节数，默认 56
+}
+
+// FederationConfig 控制对扫描发现的监控节点（has_monitor）的状态拉取
+type FederationConfig struct {
+	Enabled            bool          `yaml:"enabled"`
+	Token              string        `yaml:"token"`                // 访问对端 /api/dashboard 的 API Token，对端未开启认证时可留空
+	Scheme             string        `yaml:"scheme"`               // http 或 https，为空时设置了 token 用 https，否则用 http
+	Peers              []string      `yaml:"peers"`                // 允许接收 token 的对端地址或网段；为空时只在校验证书的 https 下发送 token
+	Port               int           `yaml:"port"`                 // 对端 API 端口，0 表示使用 monitor_port（前端反向代理 /api）
+	Interval           time.Duration `yaml:"interval"`             // 拉取间隔，默认 15s
+	Timeout            time.Duration `yaml:"timeout"`              // 单个对端的请求超时，默认 3s
+	InsecureSkipVerify bool          `yaml:"insecure_skip_verify"` // 不校验对端证书（对端使用自签名证书时）
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MonitorPort: 8041,
+		MinPrefix:   24,
+		MaxHosts:    1024,
+		Concurrency: 50,
+		CacheTTL:    60 * time.Second,
+		Ping:        PingConfig{Count: 3, Timeout: time.Second, Size: 56},
+		ARPSolicit:  true,
+		ARPTimeout:  8 * time.Second,
+
+		InventoryPath:      "inventory.json",
+		InventoryRetention: 90 * 24 * time.Hour,
+		Services:           defaultServicesConfig(),
+		Federation: FederationConfig{
+			Interval: 15 * time.Second,
+			Timeout:  3 * time.Second,
+		},
+	}
+}
+
+// scheme 返回实际使用的协议：未指定时设置了 token 用 https，避免 token 明文传输
+func (f FederationConfig) scheme() string {
+	switch {
+	case f.Scheme != "":
+		return f.Scheme
+	case f.Token != "":
+		return "https"
+	}
+	return "http"
+}
+
+// sendToken 判断是否向该对端发送 token：对端在 peers 中，或未配置 peers 时使用校验证书的 https。
+// 扫描发现的任何主机都可能在监控端口上应答，不能把 token 发给未经确认的主机
+func (f FederationConfig) sendToken(ip string) bool {
+	if f.Token == "" {
+		return false
+	}
+	if len(f.Peers) == 0 {
+		return f.scheme() == "https" && !f.InsecureSkipVerify
+	}
+	peers, _ := parseExclude(f.Peers)
+	addr := net.ParseIP(ip)
+	for _, n := range peers {
+		if n.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c Config) Validate() error {
+	if c.MonitorPort <= 0 || c.MonitorPort > 65535 {
+		return errors.New("monitor_port must be in 1-65535")
+	}
+	if c.MinPrefix < 16 || c.MinPrefix > 30 {
+		return errors.New("min_prefix must be in 16-30")
+	}
+	if c.MaxHosts <= 0 || c.Concurrency <= 0 {
+		return errors.New("max_hosts and concurrency must be positive")
+	}
+	if err := validateTargets(c.Targets, c.Exclude, c.MinPrefix); err != nil {
+		return err
+	}
+	if c.CacheTTL < 0 {
+		return errors.New("cache_ttl must not be negative")
+	}
+	if p := c.Ping; p.Count < 1 || p.Count > 20 || p.Timeout <= 0 || p.Timeout > 10*time.Second || p.Size < 0 || p.Size > 1472 {
+		return errors.New("ping.count must be in 1-20, ping.timeout in (0, 10s] and ping.size in 0-1472")
+	}
+	if c.ARPTimeout < 0 || c.ARPTimeout > time.Minute {
+		return errors.New("arp_timeout must be in 0-1m")
+	}
+	if err := c.Services.validate(); err != nil {
+		return err
+	}
+	if c.InventoryRetention < 0 {
+		return errors.New("inventory_retention must not be negative")
+	}
+	if f := c.Federation; f.Enabled {
+		if f.Scheme != "" && f.Scheme != "http" && f.Scheme != "https" {
+			return errors.New("federation.scheme must be http or https")
+		}
+		if _, err := parseExclude(f.Peers); err != nil {
+			return errors.New("federation.peers: " + err.Error())
+		}
+		if f.Token != "" && len(f.Peers) == 0 && (f.scheme() != "https" || f.InsecureSkipVerify) {
+			return errors.New("federation.token requires federation.peers unless scheme is https with certificate verification")
+		}
+		if f.Port < 0 || f.Port > 65535 {
+			return errors.New("federation.port must be in 0-65535")
+		}
+		if f.Interval < time.Second || f.Timeout <= 0 {
+			return errors.New("federation.interval must be at least 1s and federation.timeout positive")
+		}
+	}
+	return nil
+}
+
+var (
+	cfgMu sync.RWMutex
+	cfg   = DefaultConfig()
+
+	loopOnce sync.Once // 首次应用配置时启动对端拉取与定时扫描
+)
+
+// SetConfig 应用新的扫描配置，下一次扫描时生效
+func SetConfig(c Config) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	cfgMu.Lock()
+	cfg = c
+	cfgMu.Unlock()
+	loopOnce.Do(func() {
+		go peerLoop()
+		go scheduleLoop()
+	})
+	return nil
+}
+
+func currentConfig() Config {
+	cfgMu.RLock()
+	defer cfgMu.RUnlock()
+	return cfg
+}
@@ -0,0 +1,159 @@
+package lan
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+// 进程内 ICMP echo：优先使用无需特权的 ICMP datagram socket（Linux 需 net.ipv4.ping_group_range 包含当前组），
+// 不可用时回退到 raw socket（需 root 或 CAP_NET_RAW；Windows 需管理员权限）。两者都不可用时只通过 ARP 发现主机。
+
+// PingStats 是一次 ping 的统计结果，时间单位为毫秒
+type PingStats struct {
+	Sent     int     `json:"sent"`
+	Received int     `json:"received"`
+	Loss     float64 `json:"loss"` // 丢包率（%）
+	Min      float64 `json:"min"`
+	Avg      float64 `json:"avg"`
+	Max      float64 `json:"max"`
+	Jitter   float64 `json:"jitter"` // 相邻两次 RTT 之差的平均值
+}
+
+const pingInterval = 100 * time.Millisecond // 同一主机相邻两次 echo 的间隔
+
+var (
+	icmpOnce    sync.Once
+	icmpNetwork string // "udp4" 或 "ip4:icmp"
+	icmpErr     error
+	icmpSeqBase = uint32(os.Getpid())
+)
+
+// icmpSocket 确定可用的 ICMP socket 类型，只探测一次
+func icmpSocket() (string, error) {
+	icmpOnce.Do(func() {
+		for _, network := range []string{"udp4", "ip4:icmp"} {
+			conn, err := icmp.ListenPacket(network, "0.0.0.0")
+			if err == nil {
+				conn.Close()
+				icmpNetwork, icmpErr = network, nil
+				return
+			}
+			icmpErr = errors.Join(icmpErr, fmt.Errorf("%s: %w", network, err))
+		}
+		fmt.Printf("[WARN] ICMP ping unavailable (%v); set net.ipv4.ping_group_range or grant CAP_NET_RAW. Hosts are discovered via ARP only.\n", icmpErr)
+	})
+	return icmpNetwork, icmpErr
+}
+
+// ping 向 ip 发送 count 个 echo 请求，丢包率按全部请求计算；所有请求都超时才视为不可达
+func ping(ip string, pc PingConfig) (*PingStats, bool) {
+	network, err := icmpSocket()
+	if err != nil {
+		return nil, false
+	}
+	dstIP := net.ParseIP(ip).To4()
+	if dstIP == nil {
+		return nil, false
+	}
+	var dst net.Addr = &net.IPAddr{IP: dstIP}
+	if network == "udp4" {
+		dst = &net.UDPAddr{IP: dstIP}
+	}
+	conn, err := icmp.ListenPacket(network, "0.0.0.0")
+	if err != nil {
+		return nil, false
+	}
+	defer conn.Close()
+
+	// datagram socket 的 ID 由内核改写为本地端口，raw socket 会收到所有 ICMP 报文，需按 ID 过滤
+	id := int(atomic.AddUint32(&icmpSeqBase, 1) & 0xffff)
+	payload := make([]byte, pc.Size)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+	buf := make([]byte, 1500+pc.Size)
+
+	stats := &PingStats{}
+	var rtts []time.Duration
+	for seq := 0; seq < pc.Count; seq++ {
+		if seq > 0 {
+			time.Sleep(pingInterval)
+		}
+		msg := icmp.Message{Type: ipv4.ICMPTypeEcho, Body: &icmp.Echo{ID: id, Seq: seq, Data: payload}}
+		b, err := msg.Marshal(nil)
+		if err != nil {
+			return nil, false
+		}
+		start := time.Now()
+		if _, err := conn.WriteTo(b, dst); err != nil {
+			break
+		}
+		stats.Sent++
+		if rtt, ok := awaitReply(conn, buf, dstIP, id, seq, network == "udp4", start.Add(pc.Timeout)); ok {
+			rtts = append(rtts, rtt)
+		}
+	}
+	if len(rtts) == 0 {
+		return nil, false
+	}
+	stats.summarize(rtts)
+	return stats, true
+}
+
+// awaitReply 读取报文直到收到匹配的 echo reply 或超时
+func awaitReply(conn *icmp.PacketConn, buf []byte, dstIP net.IP, id, seq int, datagram bool, deadline time.Time) (time.Duration, bool) {
+	start := time.Now()
+	conn.SetReadDeadline(deadline)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			return 0, false
+		}
+		var from net.IP
+		switch a := peer.(type) {
+		case *net.UDPAddr:
+			from = a.IP
+		case *net.IPAddr:
+			from = a.IP
+		}
+		if !from.Equal(dstIP) {
+			continue
+		}
+		m, err := icmp.ParseMessage(1, buf[:n]) // 1 = IANA 协议号 ICMP
+		if err != nil || m.Type != ipv4.ICMPTypeEchoReply {
+			continue
+		}
+		echo, ok := m.Body.(*icmp.Echo)
+		if !ok || echo.Seq != seq || (!datagram && echo.ID != id) {
+			continue
+		}
+		return time.Since(start), true
+	}
+}
+
+func (s *PingStats) summarize(rtts []time.Duration) {
+	ms := func(d time.Duration) float64 { return math.Round(float64(d.Microseconds())) / 1000 }
+	s.Received = len(rtts)
+	s.Loss = math.Round(float64(s.Sent-s.Received)/float64(s.Sent)*1000) / 10
+	lo, hi, sum := rtts[0], rtts[0], time.Duration(0)
+	var diff time.Duration
+	for i, r := range rtts {
+		lo, hi, sum = min(lo, r), max(hi, r), sum+r
+		if i > 0 {
+			diff += (r - rtts[i-1]).Abs()
+		}
+	}
+	s.Min, s.Max, s.Avg = ms(lo), ms(hi), ms(sum/time.Duration(len(rtts)))
+	if len(rtts) > 1 {
+		s.Jitter = ms(diff / time.Duration(len(rtts)-1))
+	}
+}
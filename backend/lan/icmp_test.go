@@ -0,0 +1,29 @@
+package lan
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPingStatsSummarize(t *testing.T) {
+	ms := time.Millisecond
+	tests := []struct {
+		name string
+		sent int
+		rtts []time.Duration
+		want PingStats
+	}{
+		{"all replies", 3, []time.Duration{10 * ms, 20 * ms, 15 * ms}, PingStats{Sent: 3, Received: 3, Loss: 0, Min: 10, Avg: 15, Max: 20, Jitter: 7.5}},
+		{"first lost", 3, []time.Duration{12 * ms, 14 * ms}, PingStats{Sent: 3, Received: 2, Loss: 33.3, Min: 12, Avg: 13, Max: 14, Jitter: 2}},
+		{"single reply of four", 4, []time.Duration{5 * ms}, PingStats{Sent: 4, Received: 1, Loss: 75, Min: 5, Avg: 5, Max: 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := PingStats{Sent: tt.sent}
+			s.summarize(tt.rtts)
+			if s != tt.want {
+				t.Errorf("summarize = %+v, want %+v", s, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package lan
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 设备清单：记录每次扫描发现的主机，持久化到 inventory_path（JSON）。
+// 已知 MAC 的设备以 MAC 标识，IP 变化时记入 IP 历史；未知 MAC 的设备以 IP 标识，之后获得 MAC 时合并。
+
+// Device 是清单中的一台设备
+type Device struct {
+	ID         string     `json:"id"` // MAC，或 "ip:" + 地址（MAC 未知时）
+	MAC        string     `json:"mac,omitempty"`
+	Hostname   string     `json:"hostname,omitempty"` // 最近一次解析到的主机名
+	Vendor     string     `json:"vendor,omitempty"`
+	DeviceType string     `json:"device_type,omitempty"`
+	IP         string     `json:"ip"` // 最近一次出现的地址
+	FirstSeen  int64      `json:"first_seen"`
+	LastSeen   int64      `json:"last_seen"`
+	IPHistory  []IPRecord `json:"ip_history"`
+
+	Services          []Service `json:"services,omitempty"`            // 最近一次服务探测发现的开放端口
+	ServicesScannedAt int64     `json:"services_scanned_at,omitempty"` // 最近一次服务探测的时间
+}
+
+// IPRecord 是设备使用过的一个地址
+type IPRecord struct {
+	IP        string `json:"ip"`
+	FirstSeen int64  `json:"first_seen"`
+	LastSeen  int64  `json:"last_seen"`
+}
+
+const maxIPHistory = 32
+
+var (
+	invMu     sync.Mutex
+	invPath   string             // 当前已加载的清单文件
+	invLoaded bool               // invPath 是否已加载
+	devices   map[string]*Device // 受 invMu 保护
+)
+
+// loadInventory 在清单路径变化时重新读取文件，文件不存在时视为空；调用方需持有 invMu
+func loadInventory(path string) {
+	if invLoaded && path == invPath {
+		return
+	}
+	invPath, invLoaded = path, true
+	devices = make(map[string]*Device)
+	if path == "" {
+		return
+	}
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return
+	}
+	var list []*Device
+	if err == nil {
+		err = json.Unmarshal(b, &list)
+	}
+	if err != nil {
+		fmt.Printf("[ERROR] Load device inventory %s: %v\n", path, err)
+		return
+	}
+	for _, d := range list {
+		devices[d.ID] = d
+	}
+}
+
+// saveInventory 原子地写回清单文件；调用方需持有 invMu
+func saveInventory() error {
+	b, err := json.MarshalIndent(sortedDevices(), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(invPath), ".inventory-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), invPath)
+}
+
+// recordHosts 把一次扫描的结果记入清单，并回填各主机的首次发现时间；本机不记录
+func recordHosts(hosts []Host, localIP string, c Config) {
+	invMu.Lock()
+	defer invMu.Unlock()
+	loadInventory(c.InventoryPath)
+	now := time.Now().Unix()
+	for i := range hosts {
+		h := &hosts[i]
+		if h.IP == localIP {
+			continue
+		}
+		d := findDevice(h)
+		if d == nil {
+			d = &Device{FirstSeen: now}
+		}
+		if h.MAC != "" && d.MAC == "" {
+			// 原先以 IP 标识的设备获得了 MAC，改为以 MAC 标识
+			delete(devices, d.ID)
+			d.MAC = h.MAC
+		}
+		d.ID = deviceID(d.MAC, h.IP)
+		devices[d.ID] = d
+		if h.Hostname != "" {
+			d.Hostname = h.Hostname
+		}
+		if h.Vendor != "" {
+			d.Vendor = h.Vendor
+		}
+		if h.DeviceType != "" {
+			d.DeviceType = h.DeviceType
+		}
+		d.IP, d.LastSeen = h.IP, now
+		d.touchIP(h.IP, now)
+		h.FirstSeen = d.FirstSeen
+		h.Services = d.Services
+	}
+	if c.InventoryRetention > 0 {
+		cutoff := now - int64(c.InventoryRetention/time.Second)
+		for id, d := range devices {
+			if d.LastSeen < cutoff {
+				delete(devices, id)
+			}
+		}
+	}
+	if invPath == "" {
+		return
+	}
+	if err := saveInventory(); err != nil {
+		fmt.Printf("[ERROR] Save device inventory %s: %v\n", invPath, err)
+	}
+}
+
+func deviceID(mac, ip string) string {
+	if mac != "" {
+		return mac
+	}
+	return "ip:" + ip
+}
+
+// findDevice 按 MAC 查找设备；MAC 未知时按 IP 查找，也匹配当前使用该 IP 的已知 MAC 设备
+func findDevice(h *Host) *Device {
+	if h.MAC != "" {
+		if d, ok := devices[h.MAC]; ok {
+			return d
+		}
+		if d, ok := devices["ip:"+h.IP]; ok {
+			return d
+		}
+		return nil
+	}
+	if d, ok := devices["ip:"+h.IP]; ok {
+		return d
+	}
+	var found *Device
+	for _, d := range devices {
+		if d.MAC != "" && d.IP == h.IP && (found == nil || d.LastSeen > found.LastSeen) {
+			found = d
+		}
+	}
+	return found
+}
+
+// deviceByIP 返回当前使用该 IP 的设备（多个时取最近出现的）；调用方需持有 invMu
+func deviceByIP(ip string) *Device {
+	var found *Device
+	for _, d := range devices {
+		if d.IP == ip && (found == nil || d.LastSeen > found.LastSeen) {
+			found = d
+		}
+	}
+	return found
+}
+
+func (d *Device) touchIP(ip string, now int64) {
+	for i := range d.IPHistory {
+		if d.IPHistory[i].IP == ip {
+			d.IPHistory[i].LastSeen = now
+			return
+		}
+	}
+	d.IPHistory = append(d.IPHistory, IPRecord{IP: ip, FirstSeen: now, LastSeen: now})
+	if len(d.IPHistory) > maxIPHistory {
+		d.IPHistory = d.IPHistory[len(d.IPHistory)-maxIPHistory:]
+	}
+}
+
+// sortedDevices 按最近出现时间倒序返回副本；调用方需持有 invMu
+func sortedDevices() []Device {
+	list := make([]Device, 0, len(devices))
+	for _, d := range devices {
+		c := *d
+		c.IPHistory = append([]IPRecord(nil), d.IPHistory...)
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].LastSeen != list[j].LastSeen {
+			return list[i].LastSeen > list[j].LastSeen
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// Devices 返回设备清单
+func Devices() []Device {
+	invMu.Lock()
+	defer invMu.Unlock()
+	loadInventory(currentConfig().InventoryPath)
+	return sortedDevices()
+}
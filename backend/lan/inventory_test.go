@@ -0,0 +1,127 @@
+package lan
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// useInventory 让清单从 path 重新加载，测试结束后恢复
+func useInventory(t *testing.T, path string) Config {
+	t.Helper()
+	invMu.Lock()
+	prevPath, prevLoaded, prevDevices := invPath, invLoaded, devices
+	invLoaded = false
+	invMu.Unlock()
+	t.Cleanup(func() {
+		invMu.Lock()
+		invPath, invLoaded, devices = prevPath, prevLoaded, prevDevices
+		invMu.Unlock()
+	})
+	c := DefaultConfig()
+	c.InventoryPath = path
+	return c
+}
+
+// reloaded 丢弃内存中的清单，重新从文件读取
+func reloaded(c Config) map[string]Device {
+	invMu.Lock()
+	defer invMu.Unlock()
+	invLoaded = false
+	loadInventory(c.InventoryPath)
+	out := make(map[string]Device)
+	for _, d := range sortedDevices() {
+		out[d.ID] = d
+	}
+	return out
+}
+
+func TestInventoryPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inventory.json")
+	old := time.Now().Add(-200 * 24 * time.Hour).Unix()
+	seed := []Device{
+		{ID: "ip:10.0.0.5", IP: "10.0.0.5", FirstSeen: 100, LastSeen: 200, IPHistory: []IPRecord{{IP: "10.0.0.5", FirstSeen: 100, LastSeen: 200}}},
+		{ID: "aa:bb:cc:00:00:01", MAC: "aa:bb:cc:00:00:01", IP: "10.0.0.6", Hostname: "printer", FirstSeen: 150, LastSeen: time.Now().Unix()},
+		{ID: "aa:bb:cc:00:00:09", MAC: "aa:bb:cc:00:00:09", IP: "10.0.0.9", FirstSeen: old, LastSeen: old}, // 超过保留期
+	}
+	b, _ := json.Marshal(seed)
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c := useInventory(t, path)
+	c.InventoryRetention = 90 * 24 * time.Hour
+
+	hosts := []Host{
+		{IP: "10.0.0.1"}, // 本机
+		{IP: "10.0.0.5", MAC: "aa:bb:cc:00:00:05"},     // 原先以 IP 标识，获得 MAC 后合并
+		{IP: "10.0.0.7", MAC: "aa:bb:cc:00:00:01"},     // 换了地址
+		{IP: "10.0.0.8", Hostname: "nas", Vendor: "x"}, // 新设备，MAC 未知
+	}
+	recordHosts(hosts, "10.0.0.1", c)
+	if hosts[1].FirstSeen != 100 || hosts[2].FirstSeen != 150 || hosts[3].FirstSeen == 0 {
+		t.Errorf("first seen = %d, %d, %d", hosts[1].FirstSeen, hosts[2].FirstSeen, hosts[3].FirstSeen)
+	}
+	if st, err := os.Stat(path); err != nil || st.Mode().Perm() != 0o600 {
+		t.Fatalf("inventory file: %v, %v", st, err)
+	}
+
+	got := reloaded(c)
+	if len(got) != 3 {
+		t.Fatalf("devices = %v", got)
+	}
+	if _, ok := got["10.0.0.1"]; ok {
+		t.Error("local host recorded")
+	}
+	if d := got["aa:bb:cc:00:00:05"]; d.FirstSeen != 100 || d.MAC == "" || len(d.IPHistory) != 1 {
+		t.Errorf("merged device = %+v", d)
+	}
+	if _, ok := got["ip:10.0.0.5"]; ok {
+		t.Error("ip-keyed entry kept after merge")
+	}
+	moved := got["aa:bb:cc:00:00:01"]
+	if moved.IP != "10.0.0.7" || moved.Hostname != "printer" || len(moved.IPHistory) != 1 || moved.IPHistory[0].IP != "10.0.0.7" {
+		t.Errorf("moved device = %+v", moved)
+	}
+	if d := got["ip:10.0.0.8"]; d.Hostname != "nas" {
+		t.Errorf("new device = %+v", d)
+	}
+
+	// MAC 未知的主机按地址匹配到正在使用该地址的已知设备
+	recordHosts([]Host{{IP: "10.0.0.7"}}, "10.0.0.1", c)
+	if got := reloaded(c); len(got) != 3 || len(got["aa:bb:cc:00:00:01"].IPHistory) != 1 {
+		t.Errorf("devices after mac-less rescan = %v", got)
+	}
+}
+
+func TestInventoryIPHistory(t *testing.T) {
+	c := useInventory(t, "") // 不持久化
+	for i := 0; i < maxIPHistory+3; i++ {
+		recordHosts([]Host{{IP: fmt.Sprintf("10.0.1.%d", i), MAC: "aa:bb:cc:00:00:02"}}, "", c)
+	}
+	invMu.Lock()
+	list := sortedDevices()
+	invMu.Unlock()
+	if len(list) != 1 || len(list[0].IPHistory) != maxIPHistory {
+		t.Fatalf("devices = %+v", list)
+	}
+	if list[0].IPHistory[0].IP != "10.0.1.3" {
+		t.Errorf("oldest kept = %s, want 10.0.1.30", list[0].IPHistory[0].IP)
+	}
+}
+
+func TestInventoryCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inventory.json")
+	os.WriteFile(path, []byte("{not json"), 0o600)
+	c := useInventory(t, path)
+	if got := reloaded(c); len(got) != 0 {
+		t.Errorf("devices = %v", got)
+	}
+	// 下一次扫描覆盖损坏的文件
+	recordHosts([]Host{{IP: "10.0.0.2"}}, "", c)
+	if got := reloaded(c); len(got) != 1 {
+		t.Errorf("devices = %v", got)
+	}
+}
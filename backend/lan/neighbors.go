@@ -0,0 +1,71 @@
+package lan
+
+import (
+	"net"
+	"time"
+)
+
+// 基于邻居表（ARP）的主机发现：向每个地址发送一个 UDP 报文，促使内核对同网段地址发起 ARP 请求，
+// 然后读取内核邻居表。屏蔽 ICMP 的主机（如默认防火墙下的 Windows）同样会应答 ARP，因此也能被发现。
+// 该方式不需要特权；内核只会对直连网段发起 ARP，跨路由的地址不会出现在邻居表中。
+
+// Neighbor 是内核邻居表中的一项
+type Neighbor struct {
+	IP    string
+	MAC   string
+	Iface string
+	State string // reachable / stale / delay / probe / permanent / noarp / failed / incomplete，无法区分时为空
+}
+
+// confirmed 表示该项近期得到过 ARP 应答。stale / delay / probe 只说明地址曾经解析过，
+// 设备可能早已离线，仅凭这些状态计为在线会产生幽灵设备；它们要等 ARP 请求或 ping 得到应答后才算数
+func (n Neighbor) confirmed() bool {
+	switch n.State {
+	case "reachable", "permanent", "noarp", "":
+		return n.MAC != ""
+	}
+	return false
+}
+
+// pending 表示内核仍在确认该项（stale 表项被使用后依次进入 delay、probe）
+func (n Neighbor) pending() bool {
+	return n.State == "delay" || n.State == "probe" || n.State == "incomplete"
+}
+
+// solicitARP 向每个地址的 discard 端口发送一个字节，触发内核的 ARP 解析
+func solicitARP(ips []string) {
+	payload := []byte{0}
+	for _, ip := range ips {
+		conn, err := net.Dial("udp4", net.JoinHostPort(ip, "9"))
+		if err != nil {
+			continue
+		}
+		conn.Write(payload)
+		conn.Close()
+	}
+}
+
+// resolvedNeighbors 读取邻居表，等待 targets 中仍在确认的表项完成（最迟到 deadline），
+// 返回 targets 中已解析出 MAC 的表项；是否在线由调用方结合 confirmed 与 ping 结果判断
+func resolvedNeighbors(targets map[string]bool, deadline time.Time) map[string]Neighbor {
+	for {
+		table := neighbors()
+		waiting := false
+		for ip := range targets {
+			if n, ok := table[ip]; ok && n.pending() {
+				waiting = true
+				break
+			}
+		}
+		if !waiting || time.Now().After(deadline) {
+			found := make(map[string]Neighbor)
+			for ip := range targets {
+				if n, ok := table[ip]; ok && n.MAC != "" {
+					found[ip] = n
+				}
+			}
+			return found
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
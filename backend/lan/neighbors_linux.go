@@ -0,0 +1,147 @@
+package lan
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// ndmsg 之后的属性类型（linux/neighbour.h）
+const (
+	ndaDst      = 1
+	ndaLLAddr   = 2
+	sizeofNdMsg = 12
+)
+
+var nudStates = []struct {
+	flag uint16
+	name string
+}{
+	{0x80, "permanent"}, {0x02, "reachable"}, {0x10, "probe"}, {0x08, "delay"},
+	{0x04, "stale"}, {0x40, "noarp"}, {0x20, "failed"}, {0x01, "incomplete"},
+}
+
+// neighbors 通过 netlink 读取 IPv4 邻居表，失败时回退到 /proc/net/arp
+func neighbors() map[string]Neighbor {
+	if table, err := netlinkNeighbors(); err == nil {
+		return table
+	}
+	return procNeighbors()
+}
+
+func netlinkNeighbors() (map[string]Neighbor, error) {
+	b, err := syscall.NetlinkRIB(syscall.RTM_GETNEIGH, syscall.AF_INET)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := syscall.ParseNetlinkMessage(b)
+	if err != nil {
+		return nil, err
+	}
+	ifaces := make(map[int]string)
+	table := make(map[string]Neighbor)
+	for _, m := range msgs {
+		if m.Header.Type != syscall.RTM_NEWNEIGH || len(m.Data) < sizeofNdMsg {
+			continue
+		}
+		index := int(int32(binary.NativeEndian.Uint32(m.Data[4:8])))
+		state := binary.NativeEndian.Uint16(m.Data[8:10])
+		var n Neighbor
+		for attrs := m.Data[sizeofNdMsg:]; len(attrs) >= 4; {
+			l := int(binary.NativeEndian.Uint16(attrs[0:2]))
+			if l < 4 || l > len(attrs) {
+				break
+			}
+			v := attrs[4:l]
+			switch binary.NativeEndian.Uint16(attrs[2:4]) {
+			case ndaDst:
+				if len(v) == 4 {
+					n.IP = net.IP(v).String()
+				}
+			case ndaLLAddr:
+				if len(v) == 6 && !allZero(v) {
+					n.MAC = net.HardwareAddr(v).String()
+				}
+			}
+			attrs = attrs[min((l+3)&^3, len(attrs)):]
+		}
+		if n.IP == "" {
+			continue
+		}
+		for _, s := range nudStates {
+			if state&s.flag != 0 {
+				n.State = s.name
+				break
+			}
+		}
+		if _, ok := ifaces[index]; !ok {
+			if ifi, err := net.InterfaceByIndex(index); err == nil {
+				ifaces[index] = ifi.Name
+			}
+		}
+		n.Iface = ifaces[index]
+		table[n.IP] = n
+	}
+	return table, nil
+}
+
+// procNeighbors 读取 /proc/net/arp，只能区分已完成（Flags 0x2）与未完成的表项
+func procNeighbors() map[string]Neighbor {
+	table := make(map[string]Neighbor)
+	f, err := os.Open("/proc/net/arp")
+	if err != nil {
+		return table
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Scan() // 表头：IP address  HW type  Flags  HW address  Mask  Device
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 6 {
+			continue
+		}
+		n := Neighbor{IP: fields[0], Iface: fields[5], State: "incomplete"}
+		if fields[2] != "0x0" && fields[3] != "00:00:00:00:00:00" {
+			n.MAC, n.State = strings.ToLower(fields[3]), ""
+		}
+		table[n.IP] = n
+	}
+	return table
+}
+
+func allZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// defaultGateway 读取 /proc/net/route 中的 IPv4 默认网关
+func defaultGateway() string {
+	f, err := os.Open("/proc/net/route")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Scan() // 表头：Iface Destination Gateway Flags ...
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+		// 以小端十六进制表示
+		gw, err := strconv.ParseUint(fields[2], 16, 32)
+		if err != nil || gw == 0 {
+			continue
+		}
+		return net.IPv4(byte(gw), byte(gw>>8), byte(gw>>16), byte(gw>>24)).String()
+	}
+	return ""
+}
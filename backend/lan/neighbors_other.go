@@ -0,0 +1,53 @@
+//go:build !linux
+
+package lan
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// arp -a 的输出格式因系统而异：Windows 为 "192.168.1.1  00-11-22-33-44-55  dynamic"，
+// macOS / BSD 为 "? (192.168.1.1) at 0:11:22:33:44:55 on en0"（省略前导零）
+var (
+	arpIPRe  = regexp.MustCompile(`\b(\d{1,3}(?:\.\d{1,3}){3})\b`)
+	arpMACRe = regexp.MustCompile(`\b([0-9a-fA-F]{1,2}(?:[:-][0-9a-fA-F]{1,2}){5})\b`)
+)
+
+// neighbors 解析 arp -a 的输出，无法得知表项状态
+func neighbors() map[string]Neighbor {
+	table := make(map[string]Neighbor)
+	out, err := exec.Command("arp", "-a").Output()
+	if err != nil {
+		return table
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		ip := arpIPRe.FindString(line)
+		mac := arpMACRe.FindString(line)
+		if ip == "" || mac == "" || net.ParseIP(ip) == nil {
+			continue
+		}
+		parts := strings.FieldsFunc(mac, func(r rune) bool { return r == ':' || r == '-' })
+		var b strings.Builder
+		for i, p := range parts {
+			v, _ := strconv.ParseUint(p, 16, 8)
+			if i > 0 {
+				b.WriteByte(':')
+			}
+			fmt.Fprintf(&b, "%02x", v)
+		}
+		if s := b.String(); s != "00:00:00:00:00:00" && s != "ff:ff:ff:ff:ff:ff" {
+			table[ip] = Neighbor{IP: ip, MAC: s}
+		}
+	}
+	return table
+}
+
+// defaultGateway 在非 Linux 系统上不可用，默认网关不参与设备类型推测
+func defaultGateway() string {
+	return ""
+}
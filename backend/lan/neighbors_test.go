@@ -0,0 +1,27 @@
+package lan
+
+import "testing"
+
+func TestNeighborConfirmed(t *testing.T) {
+	tests := []struct {
+		state, mac string
+		want       bool
+	}{
+		{"reachable", "aa:bb:cc:dd:ee:ff", true},
+		{"permanent", "aa:bb:cc:dd:ee:ff", true},
+		{"noarp", "aa:bb:cc:dd:ee:ff", true},
+		{"", "aa:bb:cc:dd:ee:ff", true}, // /proc/net/arp 与 arp -a 无法区分状态
+		{"stale", "aa:bb:cc:dd:ee:ff", false},
+		{"delay", "aa:bb:cc:dd:ee:ff", false},
+		{"probe", "aa:bb:cc:dd:ee:ff", false},
+		{"failed", "", false},
+		{"incomplete", "", false},
+		{"reachable", "", false},
+	}
+	for _, tt := range tests {
+		n := Neighbor{IP: "192.168.1.10", MAC: tt.mac, State: tt.state}
+		if got := n.confirmed(); got != tt.want {
+			t.Errorf("confirmed(%q, %q) = %v, want %v", tt.state, tt.mac, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package lan
+
+import (
+	"bufio"
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 厂商识别：按 MAC 前缀查询 OUI 表。内置表只包含常见厂商；设置 lan.oui_path 后加载 IEEE 的 oui.txt / oui.csv
+// （或 "前缀 厂商" 格式的文本），文件中的条目覆盖内置条目，文件修改后在下次扫描时重新加载。
+
+//go:embed oui.txt
+var builtinOUI string
+
+// ouiTable 以大写十六进制前缀为键：MA-L 6 位，MA-M 7 位，MA-S 9 位
+type ouiTable map[string]string
+
+var (
+	ouiHexRe   = regexp.MustCompile(`^([0-9A-Fa-f]{2})[-:]([0-9A-Fa-f]{2})[-:]([0-9A-Fa-f]{2})\s+\(hex\)\s+(.+)$`)
+	ouiPlainRe = regexp.MustCompile(`^([0-9A-Fa-f]{6}(?:[0-9A-Fa-f](?:[0-9A-Fa-f]{2})?)?)(?:\s+\(base 16\))?\s+(.+)$`)
+)
+
+var (
+	ouiMu      sync.Mutex
+	ouiTab     ouiTable
+	ouiPath    string    // 当前已加载的外部文件
+	ouiModTime time.Time // 外部文件加载时的修改时间
+)
+
+// parseOUI 解析 OUI 文本：IEEE oui.txt、IEEE CSV（首行为 Registry,Assignment,...）或 "前缀 厂商"
+func parseOUI(r io.Reader) (ouiTable, error) {
+	br := bufio.NewReader(r)
+	if head, _ := br.Peek(9); string(head) == "Registry," {
+		return parseOUICSV(br)
+	}
+	t := make(ouiTable)
+	sc := bufio.NewScanner(br)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if m := ouiHexRe.FindStringSubmatch(line); m != nil {
+			t[strings.ToUpper(m[1]+m[2]+m[3])] = strings.TrimSpace(m[4])
+		} else if m := ouiPlainRe.FindStringSubmatch(line); m != nil {
+			t[strings.ToUpper(m[1])] = strings.TrimSpace(m[2])
+		}
+	}
+	return t, sc.Err()
+}
+
+func parseOUICSV(r io.Reader) (ouiTable, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	t := make(ouiTable)
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return t, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(rec) < 3 || rec[0] == "Registry" {
+			continue
+		}
+		if n := len(rec[1]); n == 6 || n == 7 || n == 9 {
+			t[strings.ToUpper(rec[1])] = strings.TrimSpace(rec[2])
+		}
+	}
+}
+
+// vendorTable 返回当前 OUI 表，外部文件路径或修改时间变化时重新加载；加载失败时使用内置表
+func vendorTable(path string) ouiTable {
+	ouiMu.Lock()
+	defer ouiMu.Unlock()
+	var mt time.Time
+	if path != "" {
+		if st, err := os.Stat(path); err == nil {
+			mt = st.ModTime()
+		}
+	}
+	if ouiTab != nil && path == ouiPath && mt.Equal(ouiModTime) {
+		return ouiTab
+	}
+	t, _ := parseOUI(strings.NewReader(builtinOUI))
+	if path != "" {
+		if ext, err := loadOUIFile(path); err != nil {
+			fmt.Printf("[ERROR] Load OUI table %s: %v\n", path, err)
+		} else {
+			for k, v := range ext {
+				t[k] = v
+			}
+		}
+	}
+	ouiTab, ouiPath, ouiModTime = t, path, mt
+	return t
+}
+
+func loadOUIFile(path string) (ouiTable, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseOUI(f)
+}
+
+// lookup 按最长前缀查询厂商，本地管理地址（随机 MAC）一般查不到
+func (t ouiTable) lookup(mac string) string {
+	hex := strings.ToUpper(strings.NewReplacer(":", "", "-", "", ".", "").Replace(mac))
+	for _, n := range []int{9, 7, 6} {
+		if len(hex) >= n {
+			if v, ok := t[hex[:n]]; ok {
+				return v
+			}
+		}
+	}
+	return ""
+}
+
+// 设备类型
+const (
+	DeviceRouter  = "router"
+	DevicePrinter = "printer"
+	DevicePhone   = "phone"
+	DeviceNAS     = "nas"
+	DeviceVM      = "vm"
+	DeviceCamera  = "camera"
+	DeviceIoT     = "iot"
+)
+
+// 按厂商与主机名关键字推测设备类型，先匹配的规则优先；均为小写
+var deviceRules = []struct {
+	typ      string
+	vendors  []string
+	hostname []string
+}{
+	{DeviceVM, []string{"vmware", "pcs systemtechnik", "xensource", "parallels", "qemu"}, nil},
+	{DevicePrinter, []string{"brother", "canon", "xerox", "lexmark", "seiko epson", "kyocera", "ricoh"},
+		[]string{"printer", "laserjet", "officejet", "deskjet", "epson"}},
+	{DeviceNAS, []string{"synology", "qnap", "icp electronics", "western digital"},
+		[]string{"nas", "diskstation", "synology", "qnap"}},
+	{DevicePhone, nil, []string{"iphone", "ipad", "android", "galaxy", "pixel", "phone"}},
+	{DeviceCamera, []string{"axis communications", "hikvision"}, []string{"camera", "ipcam"}},
+	{DeviceRouter, []string{"routerboard", "ubiquiti", "netgear", "tp-link", "juniper", "aruba", "fortinet", "h3c", "cisco"},
+		[]string{"router", "gateway", "firewall", "openwrt"}},
+	{DeviceIoT, []string{"espressif"}, []string{"esp32", "esp8266", "tasmota", "shelly"}},
+}
+
+// guessDeviceType 推测设备类型，无法判断时返回空字符串；默认网关视为路由器，Hyper-V 的 MAC 前缀视为虚拟机
+func guessDeviceType(h Host, gateway string) string {
+	if h.IP == gateway && gateway != "" {
+		return DeviceRouter
+	}
+	if strings.HasPrefix(strings.ToLower(h.MAC), "00:15:5d") {
+		return DeviceVM
+	}
+	vendor, hostname := strings.ToLower(h.Vendor), strings.ToLower(h.Hostname)
+	for _, r := range deviceRules {
+		for _, v := range r.vendors {
+			if strings.Contains(vendor, v) {
+				return r.typ
+			}
+		}
+		for _, k := range r.hostname {
+			if strings.Contains(hostname, k) {
+				return r.typ
+			}
+		}
+	}
+	return ""
+}
+
+// identifyHosts 填充厂商与设备类型
+func identifyHosts(hosts []Host, c Config) {
+	t := vendorTable(c.OUIPath)
+	gateway := defaultGateway()
+	for i := range hosts {
+		h := &hosts[i]
+		if h.MAC != "" {
+			h.Vendor = t.lookup(h.MAC)
+		}
+		h.DeviceType = guessDeviceType(*h, gateway)
+	}
+}
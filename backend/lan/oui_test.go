@@ -0,0 +1,107 @@
+package lan
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseOUI(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  map[string]string
+	}{
+		{
+			name: "ieee oui.txt",
+			input: `OUI/MA-L                                                    Organization
+company_id                                                  Organization
+                                                            Address
+
+00-1B-63   (hex)		Apple, Inc.
+001B63     (base 16)		Apple, Inc.
+				1 Infinite Loop
+				Cupertino  CA  95014
+				US
+
+3C-D9-2B   (hex)		Hewlett Packard
+3CD92B     (base 16)		Hewlett Packard
+`,
+			want: map[string]string{"001B63": "Apple, Inc.", "3CD92B": "Hewlett Packard"},
+		},
+		{
+			name: "ieee csv",
+			input: `Registry,Assignment,Organization Name,Organization Address
+MA-L,001B63,"Apple, Inc.",1 Infinite Loop Cupertino CA US 95014
+MA-M,70B3D51,Example MA-M,Somewhere
+MA-S,70B3D5F2A,Example MA-S,Somewhere
+MA-L,12345,Bad Length,Somewhere
+`,
+			want: map[string]string{"001B63": "Apple, Inc.", "70B3D51": "Example MA-M", "70B3D5F2A": "Example MA-S"},
+		},
+		{
+			name: "plain prefix vendor",
+			input: `# comment
+000c29	VMware, Inc.
+b827eb Raspberry Pi Foundation
+
+not a line
+`,
+			want: map[string]string{"000C29": "VMware, Inc.", "B827EB": "Raspberry Pi Foundation"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseOUI(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("table = %v, want %v", got, tt.want)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("table[%s] = %q, want %q", k, got[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestOUILookup(t *testing.T) {
+	tab := ouiTable{
+		"000C29":    "VMware, Inc.",
+		"70B3D5":    "IEEE Registration Authority",
+		"70B3D51":   "Example MA-M",
+		"70B3D5F2A": "Example MA-S",
+	}
+	tests := []struct {
+		mac, want string
+	}{
+		{"00:0c:29:ab:cd:ef", "VMware, Inc."},
+		{"00-0C-29-AB-CD-EF", "VMware, Inc."},
+		{"000c.29ab.cdef", "VMware, Inc."},
+		{"70:b3:d5:12:34:56", "Example MA-M"},
+		{"70:b3:d5:f2:a1:23", "Example MA-S"},
+		{"70:b3:d5:20:00:00", "IEEE Registration Authority"},
+		{"02:42:ac:11:00:02", ""}, // 本地管理地址
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := tab.lookup(tt.mac); got != tt.want {
+			t.Errorf("lookup(%q) = %q, want %q", tt.mac, got, tt.want)
+		}
+	}
+}
+
+func TestBuiltinOUI(t *testing.T) {
+	tab, err := parseOUI(strings.NewReader(builtinOUI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tab) < 100 {
+		t.Errorf("builtin table has %d entries", len(tab))
+	}
+	if got := tab.lookup("00:0c:29:00:00:01"); got != "VMware, Inc." {
+		t.Errorf("builtin lookup = %q", got)
+	}
+}
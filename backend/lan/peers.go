@@ -0,0 +1,220 @@
+package lan
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// federation：定期拉取扫描发现的监控节点的 /api/dashboard，把健康状况附加到拓扑结果中。
+// 拉取失败的节点标记为不可达，保留最近一次成功拉取的数据。
+
+// PeerStatus 是对端监控节点的健康状况
+type PeerStatus struct {
+	Reachable bool    `json:"reachable"`
+	Hostname  string  `json:"hostname,omitempty"` // 对端上报的主机名
+	CPU       float64 `json:"cpu"`
+	Memory    float64 `json:"memory"`
+	Alerts    int     `json:"alerts"` // 尚未恢复的告警数
+	Error     string  `json:"error,omitempty"`
+	LastSeen  int64   `json:"last_seen,omitempty"` // 最近一次拉取成功的时间
+	CheckedAt int64   `json:"checked_at"`
+}
+
+const maxPeerConcurrency = 16
+
+// peerLoop 每秒检查一次是否到达拉取间隔，配置修改后无需重启
+func peerLoop() {
+	var last time.Time
+	for range time.Tick(time.Second) {
+		c := currentConfig()
+		if !c.Federation.Enabled {
+			clearPeerStatus()
+			continue
+		}
+		if time.Since(last) < c.Federation.Interval {
+			continue
+		}
+		last = time.Now()
+		pollPeers(c)
+	}
+}
+
+func pollPeers(c Config) {
+	res := Cached()
+	var targets []string
+	for _, h := range res.Hosts {
+		if h.HasMonitor && !h.Demo && h.IP != res.LocalIP {
+			targets = append(targets, h.IP)
+		}
+	}
+	if len(targets) == 0 {
+		return
+	}
+
+	f := c.Federation
+	port := f.Port
+	if port == 0 {
+		port = c.MonitorPort
+	}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: f.InsecureSkipVerify}
+	defer tr.CloseIdleConnections()
+	client := &http.Client{Transport: tr, Timeout: f.Timeout}
+
+	results := make(map[string]*PeerStatus, len(targets))
+	var resultsMu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, min(c.Concurrency, maxPeerConcurrency))
+	for _, ip := range targets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(ip string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			url := f.scheme() + "://" + net.JoinHostPort(ip, strconv.Itoa(port)) + "/api/dashboard"
+			token := ""
+			if f.sendToken(ip) {
+				token = f.Token
+			}
+			st := fetchPeer(client, url, token)
+			if f.Token != "" && token == "" && st.Error == fmt.Sprintf("status %d", http.StatusUnauthorized) {
+				st.Error += " (token not sent: peer not in federation.peers)"
+			}
+			resultsMu.Lock()
+			results[ip] = st
+			resultsMu.Unlock()
+		}(ip)
+	}
+	wg.Wait()
+
+	mu.Lock()
+	hosts := make([]Host, len(lastResult.Hosts))
+	copy(hosts, lastResult.Hosts)
+	for i := range hosts {
+		st, ok := results[hosts[i].IP]
+		if !ok {
+			continue
+		}
+		if !st.Reachable && hosts[i].Peer != nil {
+			// 不可达时保留上次成功拉取的数据
+			prev := *hosts[i].Peer
+			prev.Reachable, prev.Error, prev.CheckedAt = false, st.Error, st.CheckedAt
+			st = &prev
+		}
+		hosts[i].Peer = st
+	}
+	lastResult.Hosts = hosts
+	res = lastResult
+	handlers := scanHandlers
+	mu.Unlock()
+	for _, fn := range handlers {
+		fn(res)
+	}
+}
+
+func fetchPeer(client *http.Client, url, token string) *PeerStatus {
+	now := time.Now().Unix()
+	st := &PeerStatus{CheckedAt: now}
+	ctx, cancel := context.WithTimeout(context.Background(), client.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		st.Error = err.Error()
+		return st
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		st.Error = err.Error()
+		return st
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		st.Error = fmt.Sprintf("status %d", resp.StatusCode)
+		return st
+	}
+	// 只解析需要的字段，不依赖 metrics 包
+	var d struct {
+		CPU struct {
+			Usage float64 `json:"usage"`
+		} `json:"cpu"`
+		Memory struct {
+			UsedPercent float64 `json:"used_percent"`
+		} `json:"memory"`
+		System struct {
+			Hostname string `json:"hostname"`
+		} `json:"system"`
+		Current []json.RawMessage `json:"current_alerts"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 8<<20)).Decode(&d); err != nil {
+		st.Error = "invalid response: " + err.Error()
+		return st
+	}
+	st.Reachable = true
+	st.Hostname = d.System.Hostname
+	st.CPU = d.CPU.Usage
+	st.Memory = d.Memory.UsedPercent
+	st.Alerts = len(d.Current)
+	st.LastSeen = now
+	return st
+}
+
+// keepPeerStatus 把上一次扫描中的对端状态带到新的扫描结果，需持有 mu
+func keepPeerStatus(hosts, prev []Host) {
+	status := make(map[string]*PeerStatus)
+	for _, h := range prev {
+		if h.Peer != nil {
+			status[h.IP] = h.Peer
+		}
+	}
+	for i := range hosts {
+		if hosts[i].HasMonitor {
+			hosts[i].Peer = status[hosts[i].IP]
+		}
+	}
+}
+
+// clearPeerStatus 关闭 federation 后去掉拓扑中的对端状态
+func clearPeerStatus() {
+	mu.Lock()
+	changed := false
+	for _, h := range lastResult.Hosts {
+		changed = changed || h.Peer != nil
+	}
+	if !changed {
+		mu.Unlock()
+		return
+	}
+	hosts := make([]Host, len(lastResult.Hosts))
+	for i, h := range lastResult.Hosts {
+		h.Peer = nil
+		hosts[i] = h
+	}
+	lastResult.Hosts = hosts
+	res := lastResult
+	handlers := scanHandlers
+	mu.Unlock()
+	for _, fn := range handlers {
+		fn(res)
+	}
+}
+
+// checkMonitorPort 检测主机是否开放监控端口，开放的主机作为 federation 的对端
+func checkMonitorPort(ip string, port int) bool {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(ip, strconv.Itoa(port)), 200*time.Millisecond)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
@@ -0,0 +1,129 @@
+package lan
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSendToken(t *testing.T) {
+	tests := []struct {
+		name string
+		f    FederationConfig
+		ip   string
+		want bool
+	}{
+		{"no token", FederationConfig{Peers: []string{"10.0.0.0/24"}}, "10.0.0.2", false},
+		{"peer in allowlist", FederationConfig{Token: "t", Scheme: "http", Peers: []string{"10.0.0.0/24"}}, "10.0.0.2", true},
+		{"peer outside allowlist", FederationConfig{Token: "t", Peers: []string{"10.0.0.0/24", "10.0.1.5"}}, "10.0.2.5", false},
+		{"single address allowlist", FederationConfig{Token: "t", Peers: []string{"10.0.1.5"}}, "10.0.1.5", true},
+		{"verified https without allowlist", FederationConfig{Token: "t"}, "10.0.2.5", true},
+		{"plain http without allowlist", FederationConfig{Token: "t", Scheme: "http"}, "10.0.2.5", false},
+		{"unverified https without allowlist", FederationConfig{Token: "t", InsecureSkipVerify: true}, "10.0.2.5", false},
+	}
+	for _, tt := range tests {
+		if got := tt.f.sendToken(tt.ip); got != tt.want {
+			t.Errorf("%s: sendToken(%s) = %v", tt.name, tt.ip, got)
+		}
+	}
+}
+
+// setResult 换上给定的扫描结果与回调，测试结束后恢复
+func setResult(t *testing.T, res ScanResult, fn func(ScanResult)) {
+	t.Helper()
+	mu.Lock()
+	prev, prevHandlers := lastResult, scanHandlers
+	lastResult, scanHandlers = res, []func(ScanResult){fn}
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		lastResult, scanHandlers = prev, prevHandlers
+		mu.Unlock()
+	})
+}
+
+func TestPollPeers(t *testing.T) {
+	var authMu sync.Mutex
+	var auth []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authMu.Lock()
+		auth = append(auth, r.Header.Get("Authorization"))
+		authMu.Unlock()
+		if r.URL.Path != "/api/dashboard" || r.Header.Get("Authorization") != "Bearer smt_peer" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"cpu":{"usage":12.5},"memory":{"used_percent":40},"system":{"hostname":"nas"},"current_alerts":[{},{}]}`))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	port, _ := strconv.Atoi(u.Port())
+
+	c := DefaultConfig()
+	c.Federation = FederationConfig{Enabled: true, Token: "smt_peer", Scheme: "http", Port: port, Timeout: c.Federation.Timeout}
+
+	tests := []struct {
+		name      string
+		peers     []string
+		wantAuth  string
+		reachable bool
+		wantErr   string
+	}{
+		{"token sent to allowed peer", []string{"127.0.0.1"}, "Bearer smt_peer", true, ""},
+		{"token withheld from other hosts", []string{"127.0.0.2"}, "", false, "status 401 (token not sent: peer not in federation.peers)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth = nil
+			var published []ScanResult
+			setResult(t, ScanResult{LocalIP: "10.9.9.9", Hosts: []Host{
+				{IP: "127.0.0.1", HasMonitor: true},
+				// 监控端口不通：标记为不可达，保留上次的数据
+				{IP: "127.0.0.2", HasMonitor: true, Peer: &PeerStatus{Reachable: true, Hostname: "old", LastSeen: 1}},
+				{IP: "10.9.9.9", HasMonitor: true}, // 本机
+				{IP: "10.9.9.10"},                  // 没有监控
+			}}, func(res ScanResult) { published = append(published, res) })
+
+			cc := c
+			cc.Federation.Peers = tt.peers
+			pollPeers(cc)
+
+			if len(auth) != 1 || auth[0] != tt.wantAuth {
+				t.Errorf("requests = %q, want one with %q", auth, tt.wantAuth)
+			}
+			hosts := Cached().Hosts
+			if len(published) != 1 {
+				t.Fatalf("published %d results", len(published))
+			}
+			p := hosts[0].Peer
+			if p == nil || p.Reachable != tt.reachable || p.Error != tt.wantErr || p.CheckedAt == 0 {
+				t.Fatalf("peer = %+v", p)
+			}
+			if tt.reachable && (p.Hostname != "nas" || p.CPU != 12.5 || p.Memory != 40 || p.Alerts != 2 || p.LastSeen == 0) {
+				t.Errorf("peer = %+v", p)
+			}
+			down := hosts[1].Peer
+			if down.Reachable || down.Hostname != "old" || down.LastSeen != 1 || !strings.Contains(down.Error, "refused") {
+				t.Errorf("unreachable peer = %+v", down)
+			}
+			if hosts[2].Peer != nil || hosts[3].Peer != nil {
+				t.Error("local or non-monitor host polled")
+			}
+		})
+	}
+}
+
+func TestClearPeerStatus(t *testing.T) {
+	var published int
+	setResult(t, ScanResult{Hosts: []Host{{IP: "10.0.0.2", HasMonitor: true, Peer: &PeerStatus{Reachable: true}}}},
+		func(ScanResult) { published++ })
+	clearPeerStatus()
+	clearPeerStatus() // 已清除时不再推送
+	if published != 1 || Cached().Hosts[0].Peer != nil {
+		t.Errorf("published = %d, peer = %+v", published, Cached().Hosts[0].Peer)
+	}
+}
@@ -0,0 +1,304 @@
+package lan
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 单个端口的探测：TCP 先读取服务端主动发送的 banner（SSH / SMTP / FTP / POP3 / IMAP 等），
+// 没有 banner 时依次尝试 TLS 握手与 HTTP 请求；UDP 对常见协议发送专用请求，收到应答即视为开放。
+
+// Service 是主机上探测到的一个开放服务
+type Service struct {
+	Port   int      `json:"port"`
+	Proto  string   `json:"proto"`            // tcp / udp
+	Name   string   `json:"name,omitempty"`   // 识别出的协议，如 ssh / http / https / smtp / ftp
+	Banner string   `json:"banner,omitempty"` // 服务标识（首行 banner、HTTP 状态行与 Server 头等）
+	TLS    *TLSInfo `json:"tls,omitempty"`
+}
+
+// TLSInfo 是服务证书的摘要
+type TLSInfo struct {
+	Subject   string   `json:"subject"`
+	Issuer    string   `json:"issuer"`
+	DNSNames  []string `json:"dns_names,omitempty"`
+	NotBefore int64    `json:"not_before"`
+	NotAfter  int64    `json:"not_after"`
+	Version   string   `json:"version"`
+}
+
+const maxBanner = 256
+
+// 通常直接以 TLS 通信的端口，先握手再发送 HTTP 请求
+var tlsPorts = map[int]bool{443: true, 465: true, 636: true, 853: true, 993: true, 995: true, 8443: true, 9443: true}
+
+func probeTCP(ip string, port int, timeout time.Duration) (Service, bool) {
+	addr := net.JoinHostPort(ip, strconv.Itoa(port))
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return Service{}, false
+	}
+	svc := Service{Port: port, Proto: "tcp"}
+
+	if !tlsPorts[port] {
+		// 服务端先发言的协议在连接后立即发送 banner
+		buf := make([]byte, 1024)
+		conn.SetReadDeadline(time.Now().Add(min(timeout, 1500*time.Millisecond)))
+		n, _ := conn.Read(buf)
+		conn.Close()
+		if n > 0 {
+			svc.Name, svc.Banner = classifyBanner(buf[:n], port)
+			return svc, true
+		}
+		if name, banner, ok := probeHTTP(addr, nil, timeout); ok {
+			svc.Name, svc.Banner = name, banner
+			// HTTPS 端口常对明文请求回 400，此时再尝试 TLS
+			if !strings.Contains(banner, " 400 ") {
+				return svc, true
+			}
+		}
+	} else {
+		conn.Close()
+	}
+
+	// 没有 banner 的端口尝试 TLS，记录证书并在其上发送 HTTP 请求
+	if info, name, banner, ok := probeTLS(ip, addr, timeout); ok {
+		svc.TLS, svc.Name, svc.Banner = info, name, banner
+	}
+	return svc, true
+}
+
+// classifyBanner 按 banner 内容识别协议，并截取首行
+func classifyBanner(b []byte, port int) (string, string) {
+	banner := sanitizeBanner(b)
+	upper := strings.ToUpper(banner)
+	switch {
+	case strings.HasPrefix(banner, "SSH-"):
+		return "ssh", banner
+	case strings.HasPrefix(banner, "220"):
+		if strings.Contains(upper, "FTP") || port == 21 {
+			return "ftp", banner
+		}
+		if strings.Contains(upper, "SMTP") || port == 25 || port == 587 {
+			return "smtp", banner
+		}
+		return "", banner
+	case strings.HasPrefix(banner, "+OK"):
+		return "pop3", banner
+	case strings.HasPrefix(banner, "* OK"):
+		return "imap", banner
+	case strings.HasPrefix(banner, "HTTP/"):
+		return "http", banner
+	}
+	if port == 3306 && len(b) > 5 && b[4] == 10 {
+		// MySQL 握手包：3 字节长度 + 序号 + 协议版本 10 + 以 NUL 结尾的服务端版本
+		if i := bytes.IndexByte(b[5:], 0); i > 0 {
+			return "mysql", sanitizeBanner(b[5 : 5+i])
+		}
+	}
+	return "", banner
+}
+
+// sanitizeBanner 取首行，去掉不可打印字符并限制长度
+func sanitizeBanner(b []byte) string {
+	if i := bytes.IndexAny(b, "\r\n"); i >= 0 {
+		b = b[:i]
+	}
+	s := strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e {
+			return -1
+		}
+		return r
+	}, string(b))
+	if len(s) > maxBanner {
+		s = s[:maxBanner]
+	}
+	return strings.TrimSpace(s)
+}
+
+// probeHTTP 发送 HEAD 请求，返回状态行与 Server 头；tlsCfg 非空时通过 TLS 发送
+func probeHTTP(addr string, tlsCfg *tls.Config, timeout time.Duration) (string, string, bool) {
+	dialer := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	var err error
+	name := "http"
+	if tlsCfg != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsCfg)
+		name = "https"
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return "", "", false
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	host, _, _ := net.SplitHostPort(addr)
+	fmt.Fprintf(conn, "HEAD / HTTP/1.0\r\nHost: %s\r\nUser-Agent: system-monitor\r\n\r\n", host)
+	buf := make([]byte, 4096)
+	n, _ := readFull(conn, buf)
+	resp := buf[:n]
+	if !bytes.HasPrefix(resp, []byte("HTTP/")) {
+		return "", "", false
+	}
+	banner := sanitizeBanner(resp)
+	for _, line := range strings.Split(string(resp), "\r\n") {
+		if k, v, ok := strings.Cut(line, ":"); ok && strings.EqualFold(k, "Server") {
+			banner += " | Server: " + sanitizeBanner([]byte(strings.TrimSpace(v)))
+			break
+		}
+	}
+	return name, banner, true
+}
+
+// readFull 读取到缓冲区满、连接关闭或超时为止
+func readFull(conn net.Conn, buf []byte) (int, error) {
+	n := 0
+	for n < len(buf) {
+		m, err := conn.Read(buf[n:])
+		n += m
+		if err != nil {
+			return n, err
+		}
+		if bytes.Contains(buf[:n], []byte("\r\n\r\n")) {
+			break
+		}
+	}
+	return n, nil
+}
+
+// probeTLS 握手并记录证书（不校验证书，只用于识别），成功后尝试 HTTPS
+func probeTLS(ip, addr string, timeout time.Duration) (*TLSInfo, string, string, bool) {
+	cfg := &tls.Config{InsecureSkipVerify: true, ServerName: ip}
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", addr, cfg)
+	if err != nil {
+		return nil, "", "", false
+	}
+	state := conn.ConnectionState()
+	conn.Close()
+	info := &TLSInfo{Version: tls.VersionName(state.Version)}
+	if len(state.PeerCertificates) > 0 {
+		fillCertInfo(info, state.PeerCertificates[0])
+	}
+	name, banner := "tls", ""
+	if n, b, ok := probeHTTP(addr, cfg, timeout); ok {
+		name, banner = n, b
+	}
+	return info, name, banner, true
+}
+
+func fillCertInfo(info *TLSInfo, cert *x509.Certificate) {
+	info.Subject = cert.Subject.String()
+	info.Issuer = cert.Issuer.String()
+	info.DNSNames = cert.DNSNames
+	info.NotBefore = cert.NotBefore.Unix()
+	info.NotAfter = cert.NotAfter.Unix()
+}
+
+// UDP 探测请求，按端口选择
+var udpProbes = map[int]struct {
+	name    string
+	payload func() []byte
+}{
+	53:   {"dns", dnsQuery},
+	123:  {"ntp", func() []byte { p := make([]byte, 48); p[0] = 0x1b; return p }}, // NTPv3 客户端请求
+	161:  {"snmp", snmpGetSysDescr},
+	1900: {"ssdp", func() []byte { return []byte(ssdpSearch) }},
+	5353: {"mdns", dnsQuery},
+}
+
+const ssdpSearch = "M-SEARCH * HTTP/1.1\r\nHOST: 239.255.255.250:1900\r\nMAN: \"ssdp:discover\"\r\nMX: 1\r\nST: ssdp:all\r\n\r\n"
+
+func probeUDP(ip string, port int, timeout time.Duration) (Service, bool) {
+	conn, err := net.DialTimeout("udp", net.JoinHostPort(ip, strconv.Itoa(port)), timeout)
+	if err != nil {
+		return Service{}, false
+	}
+	defer conn.Close()
+	svc := Service{Port: port, Proto: "udp"}
+	payload := []byte{0}
+	if p, ok := udpProbes[port]; ok {
+		svc.Name, payload = p.name, p.payload()
+	}
+	if _, err := conn.Write(payload); err != nil {
+		return Service{}, false
+	}
+	// 未收到应答时无法区分开放与被过滤，不计入结果；ICMP 端口不可达表现为读取错误
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	buf := make([]byte, 2048)
+	n, err := conn.Read(buf)
+	if err != nil || n == 0 {
+		return Service{}, false
+	}
+	switch svc.Name {
+	case "snmp":
+		svc.Banner = snmpString(buf[:n])
+	case "ssdp":
+		for _, line := range strings.Split(string(buf[:n]), "\r\n") {
+			if k, v, ok := strings.Cut(line, ":"); ok && strings.EqualFold(k, "SERVER") {
+				svc.Banner = sanitizeBanner([]byte(strings.TrimSpace(v)))
+			}
+		}
+	case "ntp":
+		if n >= 2 {
+			svc.Banner = fmt.Sprintf("stratum %d", buf[1])
+		}
+	}
+	return svc, true
+}
+
+// dnsQuery 构造对根域 NS 记录的查询
+func dnsQuery() []byte {
+	q := make([]byte, 12, 17)
+	binary.BigEndian.PutUint16(q[0:], uint16(rand.N(1<<16)))
+	binary.BigEndian.PutUint16(q[4:], 1) // QDCOUNT
+	return append(q, 0, 0, 2, 0, 1)      // 根域，QTYPE=NS，QCLASS=IN
+}
+
+// snmpGetSysDescr 构造 SNMPv2c GetRequest（community public，OID 1.3.6.1.2.1.1.1.0）
+func snmpGetSysDescr() []byte {
+	id := rand.Uint32()
+	return []byte{
+		0x30, 0x29, 0x02, 0x01, 0x01, 0x04, 0x06, 'p', 'u', 'b', 'l', 'i', 'c',
+		0xa0, 0x1c, 0x02, 0x04, byte(id >> 24), byte(id >> 16), byte(id >> 8), byte(id),
+		0x02, 0x01, 0x00, 0x02, 0x01, 0x00,
+		0x30, 0x0e, 0x30, 0x0c, 0x06, 0x08, 0x2b, 0x06, 0x01, 0x02, 0x01, 0x01, 0x01, 0x00, 0x05, 0x00,
+	}
+}
+
+// snmpString 取响应中 sysDescr OID 之后的 OCTET STRING
+func snmpString(resp []byte) string {
+	oid := []byte{0x06, 0x08, 0x2b, 0x06, 0x01, 0x02, 0x01, 0x01, 0x01, 0x00}
+	i := bytes.Index(resp, oid)
+	if i < 0 {
+		return ""
+	}
+	v := resp[i+len(oid):]
+	if len(v) < 2 || v[0] != 0x04 {
+		return ""
+	}
+	l, v := int(v[1]), v[2:]
+	if l&0x80 != 0 { // 长格式长度
+		k := l & 0x7f
+		if k == 0 || k > 2 || len(v) < k {
+			return ""
+		}
+		l = 0
+		for _, b := range v[:k] {
+			l = l<<8 | int(b)
+		}
+		v = v[k:]
+	}
+	if l > len(v) {
+		l = len(v)
+	}
+	return sanitizeBanner(v[:l])
+}
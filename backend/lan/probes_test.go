@@ -0,0 +1,86 @@
+package lan
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestClassifyBanner(t *testing.T) {
+	mysql := append([]byte{0x4a, 0, 0, 0, 10}, "8.0.36\x00\x01\x02"...)
+	tests := []struct {
+		name       string
+		banner     string
+		port       int
+		wantProto  string
+		wantBanner string
+	}{
+		{"ssh", "SSH-2.0-OpenSSH_9.6\r\n", 22, "ssh", "SSH-2.0-OpenSSH_9.6"},
+		{"ftp by text", "220 ProFTPD Server (FTP) ready\r\n", 2121, "ftp", "220 ProFTPD Server (FTP) ready"},
+		{"ftp by port", "220 Welcome\r\n", 21, "ftp", "220 Welcome"},
+		{"smtp by text", "220 mail.example.com ESMTP Postfix\r\n", 2525, "smtp", "220 mail.example.com ESMTP Postfix"},
+		{"smtp by port", "220 mail.example.com\r\n", 587, "smtp", "220 mail.example.com"},
+		{"220 unknown", "220 hello\r\n", 9999, "", "220 hello"},
+		{"pop3", "+OK Dovecot ready.\r\n", 110, "pop3", "+OK Dovecot ready."},
+		{"imap", "* OK [CAPABILITY IMAP4rev1] ready\r\n", 143, "imap", "* OK [CAPABILITY IMAP4rev1] ready"},
+		{"http", "HTTP/1.1 400 Bad Request\r\nServer: nginx\r\n", 8080, "http", "HTTP/1.1 400 Bad Request"},
+		{"mysql handshake", string(mysql), 3306, "mysql", "8.0.36"},
+		{"mysql bytes on other port", string(mysql), 3307, "", "J"}, // 协议版本 10 即换行符
+		{"unprintable stripped", "\x00\x01hello\xff world\n", 1234, "", "hello world"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proto, banner := classifyBanner([]byte(tt.banner), tt.port)
+			if proto != tt.wantProto || banner != tt.wantBanner {
+				t.Errorf("classifyBanner = (%q, %q), want (%q, %q)", proto, banner, tt.wantProto, tt.wantBanner)
+			}
+		})
+	}
+
+	if _, banner := classifyBanner([]byte(strings.Repeat("a", 1000)), 1); len(banner) != maxBanner {
+		t.Errorf("banner length = %d, want %d", len(banner), maxBanner)
+	}
+}
+
+// snmpResponse 构造带 sysDescr 值的 GetResponse 片段，lenBytes 为 OCTET STRING 的长度编码
+func snmpResponse(lenBytes []byte, value string) []byte {
+	b := []byte{0x30, 0x82, 0x00, 0x00, 0x02, 0x01, 0x01, 0x04, 0x06, 'p', 'u', 'b', 'l', 'i', 'c', 0xa2, 0x00}
+	b = append(b, 0x06, 0x08, 0x2b, 0x06, 0x01, 0x02, 0x01, 0x01, 0x01, 0x00, 0x04)
+	b = append(b, lenBytes...)
+	return append(b, value...)
+}
+
+func TestSNMPString(t *testing.T) {
+	long := strings.Repeat("x", 200)
+	tests := []struct {
+		name string
+		resp []byte
+		want string
+	}{
+		{"short length", snmpResponse([]byte{0x0b}, "Linux nas01"), "Linux nas01"},
+		{"long form length", snmpResponse([]byte{0x81, 0xc8}, long), long},
+		{"two byte length", snmpResponse([]byte{0x82, 0x00, 0x05}, "RouterOS"), "Route"},
+		{"truncated value", snmpResponse([]byte{0x20}, "HP LaserJet"), "HP LaserJet"},
+		{"multi-line value", snmpResponse([]byte{0x0d}, "Cisco IOS\r\nv15"), "Cisco IOS"},
+		{"no oid", []byte{0x30, 0x03, 0x02, 0x01, 0x01}, ""},
+		{"not octet string", append(snmpResponse(nil, "")[:27], 0x05, 0x00), ""},
+		{"unsupported length form", snmpResponse([]byte{0x83, 0, 0, 1}, "x"), ""},
+		{"empty after oid", snmpResponse(nil, "")[:27], ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := snmpString(tt.resp); got != tt.want {
+				t.Errorf("snmpString = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSNMPRequest(t *testing.T) {
+	req := snmpGetSysDescr()
+	if len(req) != int(req[1])+2 {
+		t.Errorf("message length %d, header says %d", len(req), req[1]+2)
+	}
+	if !strings.Contains(string(req), "public") {
+		t.Error("community missing")
+	}
+}
@@ -3,24 +3,80 @@ package lan
 import (
 	"fmt"
 	"net"
-	"os/exec"
-	"runtime"
 	"strings"
 	"sync"
 	"time"
 )
 
 type Host struct {
-	IP         string `json:"ip"`
-	Hostname   string `json:"hostname"`
-	Latency    string `json:"latency"` // e.g. "2ms"
-	HasMonitor bool   `json:"has_monitor"`
+	IP         string     `json:"ip"`
+	Hostname   string     `json:"hostname"`
+	Latency    string     `json:"latency"` // 平均 RTT，如 "2.0ms"；只通过 ARP 发现时为空
+	RTT        *PingStats `json:"rtt,omitempty"`
+	HasMonitor bool       `json:"has_monitor"`
+	MAC        string     `json:"mac,omitempty"`
+	Vendor     string     `json:"vendor,omitempty"`      // 按 MAC 前缀（OUI）识别的厂商
+	DeviceType string     `json:"device_type,omitempty"` // 推测的设备类型：router / printer / phone / nas / vm / camera / iot
+	FirstSeen  int64      `json:"first_seen,omitempty"`  // 设备清单中的首次发现时间
+	Demo       bool       `json:"demo,omitempty"`        // 演示模式下的虚拟设备
+	Discovery  []string   `json:"discovery,omitempty"`   // 发现方式：icmp / arp
+	Target     string     `json:"target,omitempty"`      // 发现该主机的扫描目标
+
+	Services []Service   `json:"services,omitempty"` // 服务探测发现的开放端口（来自设备清单）
+	Peer     *PeerStatus `json:"peer,omitempty"`     // 开启 federation 时对端监控的状态
 }
 
 type ScanResult struct {
-	LocalIP string `json:"local_ip"`
-	Subnet  string `json:"subnet"` // e.g. "192.168.1.0/24"
-	Hosts   []Host `json:"hosts"`
+	LocalIP string         `json:"local_ip"`
+	Subnet  string         `json:"subnet"` // 第一个目标的网段，e.g. "192.168.1.0/24"
+	Hosts   []Host         `json:"hosts"`
+	Targets []TargetStatus `json:"targets,omitempty"`
+}
+
+// TargetStatus 是单个扫描目标最近一次扫描的情况
+type TargetStatus struct {
+	Name      string `json:"name"`
+	Subnet    string `json:"subnet,omitempty"`
+	LocalIP   string `json:"local_ip,omitempty"`
+	Addresses int    `json:"addresses"`            // 扫描的地址数（已去掉排除项）
+	Hosts     int    `json:"hosts"`                // 发现的主机数
+	Interval  int64  `json:"interval,omitempty"`   // 后台定时扫描间隔（秒）
+	ScannedAt int64  `json:"scanned_at,omitempty"` // 最近一次扫描完成的时间
+	Error     string `json:"error,omitempty"`
+}
+
+// WithoutServices 返回去掉服务探测结果的副本
+func (r ScanResult) WithoutServices() ScanResult {
+	hosts := make([]Host, len(r.Hosts))
+	copy(hosts, r.Hosts)
+	for i := range hosts {
+		hosts[i].Services = nil
+	}
+	r.Hosts = hosts
+	return r
+}
+
+// scanMode 决定一次扫描包含哪些目标
+type scanMode int
+
+const (
+	scanAll       scanMode = iota // 手动触发：全部目标
+	scanOnDemand                  // 访问拓扑时缓存过期：未设置 interval 的目标
+	scanScheduled                 // 后台定时：interval 已到期的目标
+)
+
+// due 判断目标在该模式下是否需要扫描，prev 为上次的扫描情况（可能为空）；从未扫描过的目标总是需要扫描
+func (m scanMode) due(t Target, prev *TargetStatus) bool {
+	if prev == nil || prev.ScannedAt == 0 {
+		return true
+	}
+	switch m {
+	case scanOnDemand:
+		return t.Interval == 0
+	case scanScheduled:
+		return t.Interval > 0 && time.Since(time.Unix(prev.ScannedAt, 0)) >= t.Interval
+	}
+	return true
 }
 
 var (
@@ -30,125 +86,216 @@ var (
 	isScanning bool
 )
 
+var scanHandlers []func(ScanResult)
+
+// OnScan registers a callback invoked after every completed scan
+func OnScan(fn func(ScanResult)) {
+	mu.Lock()
+	scanHandlers = append(scanHandlers, fn)
+	mu.Unlock()
+}
+
 // GetTopology returns the cached topology or triggers a new scan
 func GetTopology() ScanResult {
 	mu.RLock()
-	// Cache valid for 60 seconds
-	if time.Since(lastScan) < 60*time.Second && len(lastResult.Hosts) > 0 {
+	// Cache valid for cache_ttl (default 60 seconds)
+	if time.Since(lastScan) < currentConfig().CacheTTL && len(lastResult.Hosts) > 0 {
 		defer mu.RUnlock()
 		return lastResult
 	}
 	mu.RUnlock()
+	return startScan(scanOnDemand)
+}
 
+// Cached returns the last scan result without triggering a scan
+func Cached() ScanResult {
+	mu.RLock()
+	defer mu.RUnlock()
+	return lastResult
+}
+
+// Rescan starts a background scan of every target regardless of the cache and returns the current state
+func Rescan() ScanResult {
+	return startScan(scanAll)
+}
+
+// scheduleLoop 按各目标的 interval 在后台扫描
+func scheduleLoop() {
+	for range time.Tick(10 * time.Second) {
+		c := currentConfig()
+		prev := Cached().Targets
+		for _, t := range c.Targets {
+			if scanScheduled.due(t, findStatus(prev, t.label())) {
+				startScan(scanScheduled)
+				break
+			}
+		}
+	}
+}
+
+func findStatus(list []TargetStatus, name string) *TargetStatus {
+	for i := range list {
+		if list[i].Name == name {
+			return &list[i]
+		}
+	}
+	return nil
+}
+
+func startScan(mode scanMode) ScanResult {
 	mu.Lock()
 	if isScanning {
 		mu.Unlock()
 		// Return old data (or empty) while scanning
-		return lastResult
+		return Cached()
 	}
 	isScanning = true
 	mu.Unlock()
 
 	// Start scan in background
 	go func() {
-		res := performScan()
+		mu.RLock()
+		prev := lastResult.Targets
+		mu.RUnlock()
+		res, scanned := performScan(mode, prev)
 		mu.Lock()
+		res = mergeScan(lastResult, res, scanned)
+		keepPeerStatus(res.Hosts, lastResult.Hosts)
 		lastResult = res
 		lastScan = time.Now()
 		isScanning = false
+		handlers := scanHandlers
 		mu.Unlock()
+		for _, fn := range handlers {
+			fn(res)
+		}
+		scanServices(res.Hosts)
 	}()
 
 	// Return current state immediately (might be empty on first run)
-	mu.RLock()
-	defer mu.RUnlock()
-	return lastResult
+	return Cached()
 }
 
-func performScan() ScanResult {
-	localIP, subnet, err := getLocalIPAndSubnet()
-	if err != nil {
-		fmt.Println("Error getting local IP:", err)
-		return ScanResult{}
-	}
-
-	hosts := scanSubnet(subnet, localIP)
+// performScan 扫描到期的目标；返回的 Targets 包含全部目标，scanned 为本次实际扫描的目标
+func performScan(mode scanMode, prev []TargetStatus) (ScanResult, map[string]bool) {
+	c := currentConfig()
+	var res ScanResult
+	scanned := make(map[string]bool)
+	for _, t := range resolveTargets(c) {
+		st := TargetStatus{Name: t.name, Interval: int64(t.Interval / time.Second)}
+		if t.subnet != nil {
+			st.Subnet, st.LocalIP = t.subnet.String(), t.localIP
+		}
+		if res.Subnet == "" && t.subnet != nil {
+			res.LocalIP, res.Subnet = t.localIP, st.Subnet
+		}
+		if !mode.due(t.Target, findStatus(prev, t.name)) {
+			res.Targets = append(res.Targets, st)
+			continue
+		}
+		scanned[t.name] = true
+		st.ScannedAt = time.Now().Unix()
+		if t.err != nil {
+			fmt.Printf("[ERROR] Scan target %s: %v\n", t.name, t.err)
+			st.Error = t.err.Error()
+			res.Targets = append(res.Targets, st)
+			continue
+		}
+		ips := t.addresses()
+		st.Addresses = len(ips)
+		if len(ips) > c.MaxHosts && !t.AllowLarge {
+			st.Error = fmt.Sprintf("%d addresses exceed max_hosts %d", len(ips), c.MaxHosts)
+			fmt.Printf("[ERROR] Scan target %s: %s\n", t.name, st.Error)
+			res.Targets = append(res.Targets, st)
+			continue
+		}
 
-	// [MOCK] Add some fake devices for testing topology view
-	// 假设子网是 192.168.1.x，我们随机生成几个同网段 IP
-	// 如果是其他网段，这里仅作演示，IP 可能看起来不匹配，但逻辑上能通
-	baseIP := "192.168.1."
-	if parts := strings.Split(localIP, "."); len(parts) == 4 {
-		baseIP = fmt.Sprintf("%s.%s.%s.", parts[0], parts[1], parts[2])
+		hosts := scanSubnet(ips, t.localIP, c)
+		identifyHosts(hosts, c)
+		recordHosts(hosts, t.localIP, c)
+		for i := range hosts {
+			hosts[i].Target = t.name
+		}
+		st.Hosts = len(hosts)
+		st.ScannedAt = time.Now().Unix()
+		res.Hosts = append(res.Hosts, hosts...)
+		res.Targets = append(res.Targets, st)
 	}
 
-	hosts = append(hosts, Host{IP: baseIP + "55", Hostname: "iPhone-14-Pro", Latency: "25ms", HasMonitor: false})
-	hosts = append(hosts, Host{IP: baseIP + "101", Hostname: "HP-LaserJet-M102", Latency: "4ms", HasMonitor: false})
-	hosts = append(hosts, Host{IP: baseIP + "200", Hostname: "NAS-Synology", Latency: "1ms", HasMonitor: true})
-	hosts = append(hosts, Host{IP: baseIP + "88", Hostname: "Guest-Laptop", Latency: "120ms", HasMonitor: false})
-
-	return ScanResult{
-		LocalIP: localIP,
-		Subnet:  subnet,
-		Hosts:   hosts,
+	if c.Demo {
+		res.Hosts = append(res.Hosts, demoHosts(res.LocalIP)...)
 	}
+	return res, scanned
 }
 
-func getLocalIPAndSubnet() (string, string, error) {
-	addrs, err := net.InterfaceAddrs()
-	if err != nil {
-		return "", "", err
+// mergeScan 用本次扫描的目标替换上次结果中对应的部分，未到期的目标沿用上次的主机与状态；
+// 同一地址出现在多个目标中时只保留第一个
+func mergeScan(prev, cur ScanResult, scanned map[string]bool) ScanResult {
+	byTarget := make(map[string][]Host)
+	for _, h := range prev.Hosts {
+		if h.Target != "" && !scanned[h.Target] {
+			byTarget[h.Target] = append(byTarget[h.Target], h)
+		}
+	}
+	for _, h := range cur.Hosts {
+		if h.Target != "" {
+			byTarget[h.Target] = append(byTarget[h.Target], h)
+		}
 	}
 
-	for _, addr := range addrs {
-		if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLoopback() {
-			if ipnet.IP.To4() != nil {
-				// Found IPv4
-				ones, _ := ipnet.Mask.Size()
-				// Only scan /24 for performance in this demo
-				if ones < 24 {
-					// If mask is too large (e.g. /16), we still treat it as /24 based on current IP
-					// to avoid scanning 65535 hosts
-					ones = 24
-				}
-				// Construct base subnet
-				ip := ipnet.IP.To4()
-				// Simple approach: assume /24 and just get first 3 octets
-				// Correct approach: Apply mask
-				masked := ip.Mask(net.CIDRMask(ones, 32))
-				subnet := fmt.Sprintf("%s/%d", masked.String(), ones)
-				return ip.String(), subnet, nil
+	seen := make(map[string]bool)
+	hosts := make([]Host, 0, len(cur.Hosts))
+	for i, st := range cur.Targets {
+		if !scanned[st.Name] {
+			if p := findStatus(prev.Targets, st.Name); p != nil {
+				st.Addresses, st.Hosts, st.ScannedAt, st.Error = p.Addresses, p.Hosts, p.ScannedAt, p.Error
+				cur.Targets[i] = st
+			}
+		}
+		for _, h := range byTarget[st.Name] {
+			if !seen[h.IP] {
+				seen[h.IP] = true
+				hosts = append(hosts, h)
 			}
 		}
 	}
-	return "", "", fmt.Errorf("no suitable interface found")
+	// 演示设备不属于任何目标，每次重新生成
+	for _, h := range cur.Hosts {
+		if h.Target == "" && !seen[h.IP] {
+			seen[h.IP] = true
+			hosts = append(hosts, h)
+		}
+	}
+	cur.Hosts = hosts
+	return cur
 }
 
-func scanSubnet(subnet string, localIP string) []Host {
-	ip, ipnet, err := net.ParseCIDR(subnet)
-	if err != nil {
-		return nil
+// demoHosts 生成演示用的虚拟设备（lan.demo），不记入设备清单
+func demoHosts(localIP string) []Host {
+	baseIP := "192.168.1."
+	if parts := strings.Split(localIP, "."); len(parts) == 4 {
+		baseIP = fmt.Sprintf("%s.%s.%s.", parts[0], parts[1], parts[2])
 	}
-
-	var ips []string
-	for ip := ip.Mask(ipnet.Mask); ipnet.Contains(ip); inc(ip) {
-		s := ip.String()
-		// Skip network address and broadcast (simple heuristic)
-		if strings.HasSuffix(s, ".0") || strings.HasSuffix(s, ".255") {
-			continue
-		}
-		ips = append(ips, s)
+	return []Host{
+		{IP: baseIP + "55", Hostname: "iPhone-14-Pro", Latency: "25ms", Vendor: "Apple, Inc.", DeviceType: DevicePhone, Demo: true},
+		{IP: baseIP + "101", Hostname: "HP-LaserJet-M102", Latency: "4ms", Vendor: "HP Inc.", DeviceType: DevicePrinter, Demo: true},
+		{IP: baseIP + "200", Hostname: "NAS-Synology", Latency: "1ms", HasMonitor: true, Vendor: "Synology Incorporated", DeviceType: DeviceNAS, Demo: true},
+		{IP: baseIP + "88", Hostname: "Guest-Laptop", Latency: "120ms", Demo: true},
 	}
+}
 
-	// Limit to 255 IPs to be safe
-	if len(ips) > 255 {
-		ips = ips[:255]
+// scanSubnet 探测给定的地址，结果按 ips 的顺序排列
+func scanSubnet(ips []string, localIP string, c Config) []Host {
+	// 先触发 ARP 解析，与 ping 并行进行
+	solicited := time.Now()
+	if c.ARPSolicit {
+		solicitARP(ips)
 	}
 
 	var wg sync.WaitGroup
 	// Semaphore to limit concurrency
-	sem := make(chan struct{}, 50) // 50 concurrent pings
-	var foundHosts []Host
+	sem := make(chan struct{}, c.Concurrency) // default 50 concurrent pings
+	found := make(map[string]*Host)
 	var hostsMu sync.Mutex
 
 	for _, target := range ips {
@@ -161,76 +308,81 @@ func scanSubnet(subnet string, localIP string) []Host {
 			// Check if it's me
 			if t == localIP {
 				hostsMu.Lock()
-				foundHosts = append(foundHosts, Host{
+				found[t] = &Host{
 					IP:         t,
 					Hostname:   "System Monitor (Server)",
 					Latency:    "0ms",
 					HasMonitor: true,
-				})
+				}
 				hostsMu.Unlock()
 				return
 			}
 
-			alive, lat := ping(t)
-			if alive {
-				// Check monitor port (default 8041 for frontend)
-				hasMon := checkMonitorPort(t, 8041)
-
-				// Resolve hostname
-				hostname := ""
-				names, _ := net.LookupAddr(t)
-				if len(names) > 0 {
-					hostname = strings.TrimSuffix(names[0], ".")
-				}
-
+			if stats, alive := ping(t, c.Ping); alive {
+				h := describeHost(t, c)
+				h.RTT = stats
+				h.Latency = fmt.Sprintf("%.1fms", stats.Avg)
+				h.Discovery = []string{"icmp"}
 				hostsMu.Lock()
-				foundHosts = append(foundHosts, Host{
-					IP:         t,
-					Hostname:   hostname,
-					Latency:    lat,
-					HasMonitor: hasMon,
-				})
+				found[t] = &h
 				hostsMu.Unlock()
 			}
 		}(target)
 	}
-
 	wg.Wait()
-	return foundHosts
-}
 
-func inc(ip net.IP) {
-	for j := len(ip) - 1; j >= 0; j-- {
-		ip[j]++
-		if ip[j] > 0 {
-			break
+	// 读取邻居表：补充 MAC，并加入不响应 ping 但应答了 ARP 的主机；
+	// 未得到确认的表项（stale 等）只为已响应 ping 的主机补充 MAC
+	targets := make(map[string]bool, len(ips))
+	for _, t := range ips {
+		if t != localIP {
+			targets[t] = true
 		}
 	}
-}
-
-func ping(ip string) (bool, string) {
-	var cmd *exec.Cmd
-	if runtime.GOOS == "windows" {
-		// -n 1: count 1, -w 200: timeout 200ms
-		cmd = exec.Command("ping", "-n", "1", "-w", "500", ip)
-	} else {
-		// -c 1: count 1, -W 1: timeout 1s (Linux ping usually uses seconds for -W)
-		// Some busybox ping uses -w for seconds too.
-		// We use -W 1 for standard iputils-ping
-		cmd = exec.Command("ping", "-c", "1", "-W", "1", ip)
+	var arpOnly []string
+	for t, n := range resolvedNeighbors(targets, solicited.Add(c.ARPTimeout)) {
+		if h, ok := found[t]; ok {
+			h.MAC = n.MAC
+			if n.confirmed() {
+				h.Discovery = append(h.Discovery, "arp")
+			}
+			continue
+		}
+		if !n.confirmed() {
+			continue
+		}
+		found[t] = &Host{IP: t, MAC: n.MAC, Discovery: []string{"arp"}}
+		arpOnly = append(arpOnly, t)
 	}
-
-	start := time.Now()
-	err := cmd.Run()
-	duration := time.Since(start)
-
-	if err != nil {
-		return false, ""
+	for _, t := range arpOnly {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(h *Host) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			d := describeHost(h.IP, c)
+			h.Hostname, h.HasMonitor = d.Hostname, d.HasMonitor
+		}(found[t])
 	}
+	wg.Wait()
 
-	// Format latency
-	ms := float64(duration.Microseconds()) / 1000.0
-	lat := fmt.Sprintf("%.1fms", ms)
+	foundHosts := make([]Host, 0, len(found))
+	for _, t := range ips {
+		if h, ok := found[t]; ok {
+			foundHosts = append(foundHosts, *h)
+		}
+	}
+	return foundHosts
+}
 
-	return true, lat
+// describeHost 探测监控端口并反向解析主机名
+func describeHost(ip string, c Config) Host {
+	h := Host{IP: ip}
+	// Check monitor port (default 8041 for frontend)
+	h.HasMonitor = checkMonitorPort(ip, c.MonitorPort)
+	// Resolve hostname
+	if names, _ := net.LookupAddr(ip); len(names) > 0 {
+		h.Hostname = strings.TrimSuffix(names[0], ".")
+	}
+	return h
 }
@@ -0,0 +1,215 @@
+package lan
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 服务探测：每次扫描结束后在后台对到期的主机（距上次探测超过 rescan_after）探测配置的端口，
+// 结果保存在设备清单中，随主机记录一起返回。
+
+// ServicesConfig 控制服务探测
+type ServicesConfig struct {
+	Enabled     bool          `yaml:"enabled"`
+	TCPPorts    []int         `yaml:"tcp_ports"`
+	UDPPorts    []int         `yaml:"udp_ports"`
+	PerHost     int           `yaml:"per_host"`     // 单个主机同时探测的端口数
+	Hosts       int           `yaml:"hosts"`        // 同时探测的主机数
+	Rate        int           `yaml:"rate"`         // 每秒最多发起的探测数（所有主机合计）
+	Timeout     time.Duration `yaml:"timeout"`      // 单个端口的连接 / 读取超时
+	RescanAfter time.Duration `yaml:"rescan_after"` // 同一主机两次探测的最小间隔
+}
+
+func defaultServicesConfig() ServicesConfig {
+	return ServicesConfig{
+		TCPPorts:    []int{21, 22, 23, 25, 53, 80, 110, 143, 443, 445, 587, 993, 995, 3306, 3389, 5432, 5900, 8080, 8443, 9100},
+		UDPPorts:    []int{53, 123, 161, 1900, 5353},
+		PerHost:     4,
+		Hosts:       8,
+		Rate:        100,
+		Timeout:     2 * time.Second,
+		RescanAfter: time.Hour,
+	}
+}
+
+// maxServiceRate 是 rate 的上限，限速间隔 time.Second / rate 需保持为正
+const maxServiceRate = 10000
+
+func (c ServicesConfig) validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	for _, ports := range [][]int{c.TCPPorts, c.UDPPorts} {
+		for _, p := range ports {
+			if p <= 0 || p > 65535 {
+				return fmt.Errorf("services: invalid port %d", p)
+			}
+		}
+	}
+	if c.PerHost <= 0 || c.Hosts <= 0 {
+		return errors.New("services.per_host and services.hosts must be positive")
+	}
+	if c.Rate <= 0 || c.Rate > maxServiceRate {
+		return fmt.Errorf("services.rate must be in 1-%d", maxServiceRate)
+	}
+	if c.Timeout <= 0 || c.RescanAfter < 0 {
+		return errors.New("services.timeout must be positive and services.rescan_after must not be negative")
+	}
+	return nil
+}
+
+var servicesRunning atomic.Bool
+
+// scanServices 探测到期主机的服务，上一轮未结束时跳过
+func scanServices(hosts []Host) {
+	sc := currentConfig().Services
+	if !sc.Enabled || !servicesRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer servicesRunning.Store(false)
+
+	due := dueHosts(hosts, sc.RescanAfter)
+	if len(due) == 0 {
+		return
+	}
+	tick := time.NewTicker(time.Second / time.Duration(sc.Rate))
+	defer tick.Stop()
+
+	results := make(map[string][]Service, len(due))
+	var resultsMu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, sc.Hosts)
+	for _, ip := range due {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(ip string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			svcs := scanHostServices(ip, sc, tick.C)
+			resultsMu.Lock()
+			results[ip] = svcs
+			resultsMu.Unlock()
+		}(ip)
+	}
+	wg.Wait()
+	storeServices(results)
+}
+
+// dueHosts 返回设备清单中距上次服务探测超过 rescanAfter 的主机（本机与演示设备不在清单中）
+func dueHosts(hosts []Host, rescanAfter time.Duration) []string {
+	invMu.Lock()
+	defer invMu.Unlock()
+	cutoff := time.Now().Add(-rescanAfter).Unix()
+	var due []string
+	for _, h := range hosts {
+		if d := deviceByIP(h.IP); d != nil && d.ServicesScannedAt <= cutoff {
+			due = append(due, h.IP)
+		}
+	}
+	return due
+}
+
+// scanHostServices 探测单个主机的全部端口，tick 用于全局限速
+func scanHostServices(ip string, sc ServicesConfig, tick <-chan time.Time) []Service {
+	var (
+		svcs   = []Service{}
+		svcsMu sync.Mutex
+		wg     sync.WaitGroup
+		sem    = make(chan struct{}, sc.PerHost)
+	)
+	probe := func(fn func(string, int, time.Duration) (Service, bool), port int) {
+		<-tick
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if svc, ok := fn(ip, port, sc.Timeout); ok {
+				svcsMu.Lock()
+				svcs = append(svcs, svc)
+				svcsMu.Unlock()
+			}
+		}()
+	}
+	for _, port := range sc.TCPPorts {
+		probe(probeTCP, port)
+	}
+	for _, port := range sc.UDPPorts {
+		probe(probeUDP, port)
+	}
+	wg.Wait()
+	sort.Slice(svcs, func(i, j int) bool {
+		if svcs[i].Proto != svcs[j].Proto {
+			return svcs[i].Proto == "tcp"
+		}
+		return svcs[i].Port < svcs[j].Port
+	})
+	return svcs
+}
+
+// storeServices 把探测结果写入设备清单与最近一次扫描结果
+func storeServices(results map[string][]Service) {
+	now := time.Now().Unix()
+	invMu.Lock()
+	for ip, svcs := range results {
+		if d := deviceByIP(ip); d != nil {
+			d.Services, d.ServicesScannedAt = svcs, now
+		}
+	}
+	if invPath != "" {
+		if err := saveInventory(); err != nil {
+			fmt.Printf("[ERROR] Save device inventory %s: %v\n", invPath, err)
+		}
+	}
+	invMu.Unlock()
+
+	mu.Lock()
+	hosts := make([]Host, len(lastResult.Hosts))
+	copy(hosts, lastResult.Hosts)
+	for i := range hosts {
+		if svcs, ok := results[hosts[i].IP]; ok {
+			hosts[i].Services = svcs
+		}
+	}
+	lastResult.Hosts = hosts
+	res := lastResult
+	handlers := scanHandlers
+	mu.Unlock()
+	for _, fn := range handlers {
+		fn(res)
+	}
+}
+
+// HostDetail 是单个主机的详细信息
+type HostDetail struct {
+	Host   *Host   `json:"host,omitempty"`   // 最近一次扫描结果，主机本次未出现时为空
+	Device *Device `json:"device,omitempty"` // 设备清单记录（含服务探测结果），本机与演示设备没有
+}
+
+// LookupHost 按 IP 查找最近一次扫描结果与设备清单中的记录
+func LookupHost(ip string) (HostDetail, bool) {
+	var detail HostDetail
+	mu.RLock()
+	for _, h := range lastResult.Hosts {
+		if h.IP == ip {
+			h := h
+			detail.Host = &h
+			break
+		}
+	}
+	mu.RUnlock()
+
+	invMu.Lock()
+	loadInventory(currentConfig().InventoryPath)
+	if d := deviceByIP(ip); d != nil {
+		c := *d
+		c.IPHistory = append([]IPRecord(nil), d.IPHistory...)
+		detail.Device = &c
+	}
+	invMu.Unlock()
+	return detail, detail.Host != nil || detail.Device != nil
+}
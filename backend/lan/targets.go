@@ -0,0 +1,220 @@
+package lan
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// 扫描目标：未配置 targets 时扫描第一个非回环网卡所在的网段（按 min_prefix 收窄）；
+// 配置后依次扫描每个目标，各目标可单独设置排除列表与后台定时扫描间隔。
+
+// maxPrefixLen 是 allow_large 允许的最大网段（/16，65534 个地址）
+const maxPrefixLen = 16
+
+// Target 是一个扫描目标，interface 与 cidr 二选一
+type Target struct {
+	Name       string        `yaml:"name"`        // 显示名，默认为 interface 或 cidr
+	Interface  string        `yaml:"interface"`   // 扫描该网卡第一个 IPv4 地址所在的网段
+	CIDR       string        `yaml:"cidr"`        // 直接指定 IPv4 网段，如 10.0.0.0/22
+	Exclude    []string      `yaml:"exclude"`     // 不扫描的地址或网段
+	Interval   time.Duration `yaml:"interval"`    // 后台定时扫描间隔，0 表示只在访问拓扑或手动触发时扫描
+	AllowLarge bool          `yaml:"allow_large"` // 允许扫描前缀短于 min_prefix 的网段（最大 /16），且不受 max_hosts 限制
+}
+
+// label 返回目标的名称
+func (t Target) label() string {
+	switch {
+	case t.Name != "":
+		return t.Name
+	case t.Interface != "":
+		return t.Interface
+	}
+	return t.CIDR
+}
+
+func (t Target) validate(minPrefix int) error {
+	if (t.Interface == "") == (t.CIDR == "") {
+		return fmt.Errorf("targets: %q must set exactly one of interface and cidr", t.label())
+	}
+	if t.CIDR != "" {
+		ip, ipnet, err := net.ParseCIDR(t.CIDR)
+		if err != nil || ip.To4() == nil {
+			return fmt.Errorf("targets: invalid IPv4 cidr %q", t.CIDR)
+		}
+		ones, _ := ipnet.Mask.Size()
+		if ones < maxPrefixLen {
+			return fmt.Errorf("targets: %q is larger than /%d", t.CIDR, maxPrefixLen)
+		}
+		if ones < minPrefix && !t.AllowLarge {
+			return fmt.Errorf("targets: %q is larger than min_prefix /%d, set allow_large to scan it", t.CIDR, minPrefix)
+		}
+	}
+	if _, err := parseExclude(t.Exclude); err != nil {
+		return fmt.Errorf("targets: %q: %w", t.label(), err)
+	}
+	if t.Interval < 0 || (t.Interval > 0 && t.Interval < time.Minute) {
+		return fmt.Errorf("targets: %q interval must be 0 or at least 1m", t.label())
+	}
+	return nil
+}
+
+func validateTargets(targets []Target, exclude []string, minPrefix int) error {
+	names := make(map[string]bool, len(targets))
+	for _, t := range targets {
+		if err := t.validate(minPrefix); err != nil {
+			return err
+		}
+		if names[t.label()] {
+			return fmt.Errorf("targets: duplicate target name %q", t.label())
+		}
+		names[t.label()] = true
+	}
+	if _, err := parseExclude(exclude); err != nil {
+		return errors.New("exclude: " + err.Error())
+	}
+	return nil
+}
+
+// parseExclude 解析地址或网段列表，单个地址视为 /32
+func parseExclude(list []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(list))
+	for _, s := range list {
+		cidr := s
+		if !strings.Contains(cidr, "/") {
+			cidr += "/32"
+		}
+		ip, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil || ip.To4() == nil {
+			return nil, fmt.Errorf("invalid IPv4 address or cidr %q", s)
+		}
+		nets = append(nets, ipnet)
+	}
+	return nets, nil
+}
+
+// scanTarget 是解析到具体网段的扫描目标
+type scanTarget struct {
+	Target
+	name    string
+	subnet  *net.IPNet
+	localIP string       // 本机在该网段的地址，没有时为空
+	exclude []*net.IPNet // 目标与全局的排除项
+	err     error        // 网卡不存在等解析错误
+}
+
+// resolveTargets 把配置的目标解析为网段；未配置时使用第一个非回环网卡
+func resolveTargets(c Config) []scanTarget {
+	targets := c.Targets
+	auto := len(targets) == 0
+	if auto {
+		targets = []Target{{}}
+	}
+	global, _ := parseExclude(c.Exclude)
+	out := make([]scanTarget, 0, len(targets))
+	for _, t := range targets {
+		st := scanTarget{Target: t, name: t.label()}
+		own, _ := parseExclude(t.Exclude)
+		st.exclude = append(own, global...)
+		if t.CIDR != "" {
+			_, st.subnet, _ = net.ParseCIDR(t.CIDR)
+			st.localIP = localIPIn(st.subnet)
+		} else {
+			floor := c.MinPrefix
+			if t.AllowLarge {
+				floor = maxPrefixLen
+			}
+			var iface string
+			iface, st.localIP, st.subnet, st.err = getLocalIPAndSubnet(t.Interface, floor)
+			if auto {
+				st.name = iface
+			}
+		}
+		out = append(out, st)
+	}
+	return out
+}
+
+// getLocalIPAndSubnet 返回网卡（为空时为第一个非回环网卡）的名称、第一个 IPv4 地址与所在网段；
+// 掩码短于 minPrefix 时收窄为本机地址所在的 /minPrefix，避免扫描过大网段
+func getLocalIPAndSubnet(name string, minPrefix int) (string, string, *net.IPNet, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return "", "", nil, err
+	}
+	for _, iface := range ifaces {
+		if name != "" && iface.Name != name {
+			continue
+		}
+		if name == "" && (iface.Flags&net.FlagLoopback != 0 || iface.Flags&net.FlagUp == 0) {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok || ipnet.IP.To4() == nil {
+				continue
+			}
+			ip := ipnet.IP.To4()
+			ones, _ := ipnet.Mask.Size()
+			ones = max(ones, minPrefix)
+			mask := net.CIDRMask(ones, 32)
+			return iface.Name, ip.String(), &net.IPNet{IP: ip.Mask(mask), Mask: mask}, nil
+		}
+		if name != "" {
+			return "", "", nil, fmt.Errorf("interface %s has no IPv4 address", name)
+		}
+	}
+	if name != "" {
+		return "", "", nil, fmt.Errorf("interface %s not found", name)
+	}
+	return "", "", nil, fmt.Errorf("no suitable interface found")
+}
+
+// localIPIn 返回本机在网段中的地址
+func localIPIn(subnet *net.IPNet) string {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return ""
+	}
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.To4() != nil && subnet.Contains(ipnet.IP) {
+			return ipnet.IP.To4().String()
+		}
+	}
+	return ""
+}
+
+// addresses 列出网段中要扫描的地址：/30 及更小的网段去掉网络地址与广播地址，再去掉排除项
+func (t scanTarget) addresses() []string {
+	ones, bits := t.subnet.Mask.Size()
+	first := binary.BigEndian.Uint32(t.subnet.IP.To4())
+	last := first | (1<<(bits-ones) - 1)
+	if ones <= 30 {
+		first, last = first+1, last-1
+	}
+	ips := make([]string, 0, last-first+1)
+	ip := make(net.IP, 4)
+	for n := uint64(first); n <= uint64(last); n++ {
+		binary.BigEndian.PutUint32(ip, uint32(n))
+		if !t.excluded(ip) {
+			ips = append(ips, ip.String())
+		}
+	}
+	return ips
+}
+
+func (t scanTarget) excluded(ip net.IP) bool {
+	for _, n := range t.exclude {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
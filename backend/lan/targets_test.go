@@ -0,0 +1,124 @@
+package lan
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseExclude(t *testing.T) {
+	tests := []struct {
+		name    string
+		list    []string
+		want    []string // 解析后的网段
+		wantErr string
+	}{
+		{"empty", nil, []string{}, ""},
+		{"single address is /32", []string{"192.168.1.1"}, []string{"192.168.1.1/32"}, ""},
+		{"cidr is masked", []string{"10.0.0.7/24", "172.16.0.0/12"}, []string{"10.0.0.0/24", "172.16.0.0/12"}, ""},
+		{"ipv6 rejected", []string{"fe80::1"}, nil, `"fe80::1"`},
+		{"garbage rejected with original text", []string{"192.168.1.300"}, nil, `"192.168.1.300"`},
+		{"bad prefix", []string{"10.0.0.0/33"}, nil, "10.0.0.0/33"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nets, err := parseExclude(tt.list)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, len(nets))
+			for i, n := range nets {
+				got[i] = n.String()
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("nets = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanTargetAddresses(t *testing.T) {
+	mustNet := func(s string) *net.IPNet {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	tests := []struct {
+		name    string
+		subnet  string
+		exclude []string
+		count   int
+		first   string
+		last    string
+	}{
+		{"/24 drops network and broadcast", "192.168.1.0/24", nil, 254, "192.168.1.1", "192.168.1.254"},
+		{"/30", "10.0.0.4/30", nil, 2, "10.0.0.5", "10.0.0.6"},
+		{"/31 keeps both", "10.0.0.4/31", nil, 2, "10.0.0.4", "10.0.0.5"},
+		{"/32", "10.0.0.9/32", nil, 1, "10.0.0.9", "10.0.0.9"},
+		{"/22", "10.1.0.0/22", nil, 1022, "10.1.0.1", "10.1.3.254"},
+		{"exclude address and range", "192.168.1.0/24", []string{"192.168.1.1", "192.168.1.128/25"}, 126, "192.168.1.2", "192.168.1.127"},
+		{"exclude everything", "192.168.1.0/30", []string{"192.168.1.0/24"}, 0, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ex, err := parseExclude(tt.exclude)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ips := scanTarget{subnet: mustNet(tt.subnet), exclude: ex}.addresses()
+			if len(ips) != tt.count {
+				t.Fatalf("len = %d, want %d", len(ips), tt.count)
+			}
+			if tt.count == 0 {
+				return
+			}
+			if ips[0] != tt.first || ips[len(ips)-1] != tt.last {
+				t.Errorf("range = %s..%s, want %s..%s", ips[0], ips[len(ips)-1], tt.first, tt.last)
+			}
+		})
+	}
+}
+
+func TestValidateTargets(t *testing.T) {
+	tests := []struct {
+		name    string
+		targets []Target
+		exclude []string
+		wantErr string
+	}{
+		{"ok", []Target{{CIDR: "10.0.0.0/24"}, {Interface: "eth0", Interval: time.Hour}}, []string{"10.0.0.1"}, ""},
+		{"both interface and cidr", []Target{{Interface: "eth0", CIDR: "10.0.0.0/24"}}, nil, "exactly one"},
+		{"neither", []Target{{Name: "x"}}, nil, "exactly one"},
+		{"ipv6 cidr", []Target{{CIDR: "fd00::/64"}}, nil, "invalid IPv4 cidr"},
+		{"larger than /16", []Target{{CIDR: "10.0.0.0/8", AllowLarge: true}}, nil, "larger than /16"},
+		{"larger than min_prefix", []Target{{CIDR: "10.0.0.0/22"}}, nil, "allow_large"},
+		{"allow_large", []Target{{CIDR: "10.0.0.0/22", AllowLarge: true}}, nil, ""},
+		{"short interval", []Target{{CIDR: "10.0.0.0/24", Interval: 30 * time.Second}}, nil, "at least 1m"},
+		{"bad target exclude", []Target{{CIDR: "10.0.0.0/24", Exclude: []string{"x"}}}, nil, `"10.0.0.0/24"`},
+		{"duplicate name", []Target{{CIDR: "10.0.0.0/24", Name: "a"}, {CIDR: "10.0.1.0/24", Name: "a"}}, nil, "duplicate"},
+		{"bad global exclude", nil, []string{"x"}, "exclude:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTargets(tt.targets, tt.exclude, 24)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
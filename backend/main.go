@@ -1,78 +1,572 @@
 package main
 
 import (
-	"encoding/json"
+	"bufio"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
+	"system-monitor/auth"
+	"system-monitor/certs"
+	"system-monitor/config"
+	"system-monitor/fleet"
 	"system-monitor/lan"
 	"system-monitor/metrics"
+	"system-monitor/notify"
+	"system-monitor/stream"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
+	// system-monitor hash-password：从标准输入读取密码，输出用于 auth.users 的 bcrypt 摘要
+	if len(os.Args) > 1 && os.Args[1] == "hash-password" {
+		hashPassword()
+		return
+	}
+	// system-monitor agent：只采集并推送到中心服务（fleet.agent），不提供 HTTP 接口
+	agentOnly := len(os.Args) > 1 && os.Args[1] == "agent"
+
+	if agentOnly {
+		config.SetAgentOnly() // 不提供 HTTP 接口，也就不需要认证、历史数据库、局域网扫描与告警通知
+	} else {
+		notify.Init() // 告警通知渠道，需在采集开始前注册
+		stream.Init() // SSE 广播中心，同样需在采集开始前注册
+	}
+	fleet.Init() // agent 推送，同样需在采集开始前注册
+	if err := config.Init(); err != nil {
+		fmt.Println("[FATAL]", err)
+		os.Exit(1)
+	}
+	config.Watch()           // SIGHUP 或配置文件修改时热加载
 	metrics.StartCollector() // 启动数据采集
 
+	if agentOnly {
+		if !fleet.AgentEnabled() {
+			fmt.Println("[FATAL] agent mode requires fleet.agent.server (or AGENT_SERVER)")
+			os.Exit(1)
+		}
+		select {}
+	}
+
 	r := gin.Default()
 
+	// 登录：校验本地用户密码，签发会话 Token（同时写入 HttpOnly Cookie，供浏览器与 SSE 使用）
+	r.POST("/api/auth/login", func(c *gin.Context) {
+		var body struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		token, expires, err := auth.Login(body.Username, body.Password)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.SetSameSite(http.SameSiteStrictMode)
+		c.SetCookie(sessionCookie, token, int(time.Until(expires).Seconds()), "/", "", c.Request.TLS != nil, true)
+		c.JSON(http.StatusOK, gin.H{"token": token, "username": body.Username, "expires_at": expires.Unix()})
+	})
+
+	// 其余 /api/* 接口均需认证：Authorization: Bearer <会话 Token 或 API Token>，或登录 Cookie
+	api := r.Group("/api", requireAuth())
+
+	api.POST("/auth/logout", func(c *gin.Context) {
+		if token := requestToken(c); token != "" {
+			auth.Logout(token)
+		}
+		c.SetCookie(sessionCookie, "", -1, "/", "", c.Request.TLS != nil, true)
+		c.Status(http.StatusNoContent)
+	})
+
+	api.GET("/auth/me", func(c *gin.Context) {
+		c.JSON(http.StatusOK, currentPrincipal(c))
+	})
+
+	// API Token：供脚本使用，明文只在创建时返回一次
+	api.GET("/auth/tokens", func(c *gin.Context) {
+		c.JSON(http.StatusOK, auth.ListTokens(currentPrincipal(c).Username))
+	})
+
+	api.POST("/auth/tokens", func(c *gin.Context) {
+		var body struct {
+			Name string `json:"name"`
+		}
+		_ = c.ShouldBindJSON(&body)
+		plain, t, err := auth.CreateToken(currentPrincipal(c).Username, body.Name)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"token": plain, "info": t})
+	})
+
+	api.DELETE("/auth/tokens/:id", func(c *gin.Context) {
+		err := auth.DeleteToken(currentPrincipal(c).Username, c.Param("id"))
+		if errors.Is(err, auth.ErrTokenNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
 	// 提供前端请求的 API
-	r.GET("/api/dashboard", func(c *gin.Context) {
+	// /api/dashboard?host=<主机名>：查看某台 agent 最近一次推送的数据，省略时为本机
+	api.GET("/dashboard", func(c *gin.Context) {
 		c.Writer.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		metrics.Mu.RLock()
-		data := metrics.Latest
-		metrics.Mu.RUnlock()
+		p := currentPrincipal(c)
+		data := dashboardFor(p)
+		if host := c.Query("host"); host != "" && host != data.System.Hostname {
+			var ok bool
+			if data, ok = fleet.Dashboard(host); !ok {
+				c.JSON(http.StatusNotFound, gin.H{"error": "unknown host " + host})
+				return
+			}
+			if !p.Role.Allows(auth.RoleOperator) {
+				data = data.WithoutAudit()
+			}
+		}
 		c.JSON(http.StatusOK, data)
 	})
 
-	r.GET("/api/alerts", func(c *gin.Context) {
+	// 主机列表：本机与所有向本机推送过数据的 agent
+	api.GET("/hosts", func(c *gin.Context) {
+		c.JSON(http.StatusOK, fleet.Hosts())
+	})
+
+	// agent 推送入口（fleet.server.enabled），使用 operator 及以上的 API Token
+	api.POST("/agent/push", requireRole(auth.RoleOperator), func(c *gin.Context) {
+		if !fleet.ServerEnabled() {
+			c.JSON(http.StatusNotFound, gin.H{"error": "fleet server is disabled"})
+			return
+		}
+		rep, err := fleet.ReadReport(c.Request)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		fleet.Receive(rep, c.ClientIP())
+		c.Status(http.StatusNoContent)
+	})
+
+	// 历史趋势：/api/history?metric=cpu_usage&start=...&end=...&step=1m&path=/&interface=eth0&core=0
+	api.GET("/history", func(c *gin.Context) {
+		metric := c.Query("metric")
+		if metric == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "metric is required"})
+			return
+		}
+		now := time.Now()
+		end, err := parseTimeParam(c.Query("end"), now)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid end: " + err.Error()})
+			return
+		}
+		start, err := parseTimeParam(c.Query("start"), end.Add(-time.Hour))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid start: " + err.Error()})
+			return
+		}
+		if !start.Before(end) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "start must be before end"})
+			return
+		}
+		// 默认按 300 个点自动计算步长
+		step, err := parseStepParam(c.Query("step"), end.Sub(start)/300)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid step: " + err.Error()})
+			return
+		}
+		if end.Sub(start)/step > 11000 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "too many points, increase step"})
+			return
+		}
+		labels := map[string]string{}
+		for _, k := range []string{"path", "interface", "core"} {
+			if v, ok := c.GetQuery(k); ok {
+				labels[k] = v
+			}
+		}
+		res, err := metrics.QueryHistory(metrics.HistoryQuery{Metric: metric, Labels: labels, Start: start, End: end, Step: step})
+		if errors.Is(err, metrics.ErrHistoryDisabled) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+		var labelErr *metrics.HistoryLabelError
+		if errors.As(err, &labelErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	})
+
+	api.GET("/alerts", func(c *gin.Context) {
 		limitStr := c.DefaultQuery("limit", "20")
 		offsetStr := c.DefaultQuery("offset", "0")
 		limit, _ := strconv.Atoi(limitStr)
 		offset, _ := strconv.Atoi(offsetStr)
-		items, total := metrics.GetAlerts(limit, offset)
+		items, total := metrics.GetAlerts(limit, offset, c.Query("state"))
 		c.JSON(http.StatusOK, gin.H{"items": items, "total": total})
 	})
 
-	// LAN Topology
-	r.GET("/api/lan", func(c *gin.Context) {
-		data := lan.GetTopology()
+	api.POST("/alerts/:id/ack", requireRole(auth.RoleOperator), func(c *gin.Context) {
+		a, err := metrics.AckAlert(c.Param("id"), currentPrincipal(c).Username)
+		switch {
+		case errors.Is(err, metrics.ErrAlertNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, metrics.ErrAlertResolved):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "alert": a})
+		default:
+			c.JSON(http.StatusOK, a)
+		}
+	})
+
+	// 进程资源表：/api/processes?sort=cpu_percent&order=desc&limit=20
+	api.GET("/processes", requireRole(auth.RoleOperator), func(c *gin.Context) {
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+		items, total, err := metrics.GetProcesses(c.Query("sort"), c.DefaultQuery("order", "desc"), limit)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"items": items, "total": total})
+	})
+
+	api.GET("/processes/tree", requireRole(auth.RoleOperator), func(c *gin.Context) {
+		c.JSON(http.StatusOK, metrics.GetProcessTree())
+	})
+
+	api.GET("/processes/:pid/ancestry", requireRole(auth.RoleOperator), func(c *gin.Context) {
+		pid, err := strconv.ParseInt(c.Param("pid"), 10, 32)
+		if err != nil || pid <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid pid"})
+			return
+		}
+		chain, err := metrics.GetAncestry(int32(pid))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, chain)
+	})
+
+	// 运行时配置：读取 / 修改采集与扫描参数，修改会写回配置文件
+	api.GET("/config", requireRole(auth.RoleAdmin), func(c *gin.Context) {
+		b, err := config.RuntimeJSON()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Data(http.StatusOK, "application/json; charset=utf-8", b)
+	})
+
+	api.PUT("/config", requireRole(auth.RoleAdmin), func(c *gin.Context) {
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		err = config.UpdateRuntime(body)
+		var verr *config.ValidationError
+		if errors.As(err, &verr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		b, _ := config.RuntimeJSON()
+		c.Data(http.StatusOK, "application/json; charset=utf-8", b)
+	})
+
+	// LAN Topology：只有 admin 的访问会在缓存过期时触发扫描，其余角色只读取上次结果；
+	// 服务探测结果属于安全审计数据，viewer 看不到
+	api.GET("/lan", func(c *gin.Context) {
+		p := currentPrincipal(c)
+		var data lan.ScanResult
+		if p.Role.Allows(auth.RoleAdmin) {
+			data = lan.GetTopology()
+		} else {
+			data = lan.Cached()
+		}
+		if !p.Role.Allows(auth.RoleOperator) {
+			data = data.WithoutServices()
+		}
 		c.JSON(http.StatusOK, data)
 	})
 
-	r.GET("/api/stream", func(c *gin.Context) {
+	api.POST("/lan/scan", requireRole(auth.RoleAdmin), func(c *gin.Context) {
+		c.JSON(http.StatusAccepted, lan.Rescan())
+	})
+
+	// 设备清单：历次扫描发现的设备（MAC、主机名、首次 / 最近出现时间、IP 历史）
+	api.GET("/lan/devices", requireRole(auth.RoleOperator), func(c *gin.Context) {
+		c.JSON(http.StatusOK, lan.Devices())
+	})
+
+	// 单个主机的详细信息，含服务探测结果
+	api.GET("/lan/hosts/:ip", requireRole(auth.RoleOperator), func(c *gin.Context) {
+		ip := net.ParseIP(c.Param("ip"))
+		if ip == nil || ip.To4() == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid IPv4 address"})
+			return
+		}
+		detail, ok := lan.LookupHost(ip.String())
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "host not found"})
+			return
+		}
+		c.JSON(http.StatusOK, detail)
+	})
+
+	// 存活检查：不需要认证，供容器健康检查使用（wget --spider 发送 HEAD）
+	r.Match([]string{http.MethodGet, http.MethodHead}, "/healthz", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+
+	// Prometheus / OpenMetrics 抓取端点，按 Accept 头协商格式
+	r.GET("/metrics", func(c *gin.Context) {
+		openMetrics := strings.Contains(c.GetHeader("Accept"), "application/openmetrics-text")
+		contentType := metrics.PromContentType
+		if openMetrics {
+			contentType = metrics.OpenMetricsContentType
+		}
+		c.Data(http.StatusOK, contentType, metrics.WritePrometheus(openMetrics))
+	})
+
+	// SSE：/api/stream 每周期推送完整 dashboard；/api/stream?topics=perf,alerts 按主题推送增量
+	api.GET("/stream", func(c *gin.Context) {
+		audit := currentPrincipal(c).Role.Allows(auth.RoleOperator)
+		var sub *stream.Subscriber
+		if v, ok := c.GetQuery("topics"); ok {
+			topics, err := stream.ParseTopics(v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			for _, t := range topics {
+				if stream.AuditTopic(t) && !audit {
+					c.JSON(http.StatusForbidden, gin.H{"error": "topic " + t + " requires role operator"})
+					return
+				}
+			}
+			// EventSource 重连时自动携带 Last-Event-ID 头，也可通过查询参数指定
+			lastID := c.GetHeader("Last-Event-ID")
+			if lastID == "" {
+				lastID = c.Query("last_event_id")
+			}
+			sub = stream.SubscribeTopics(topics, lastID, audit)
+		} else {
+			sub = stream.Subscribe(audit)
+		}
+		defer stream.Unsubscribe(sub)
+
 		c.Writer.Header().Set("Content-Type", "text/event-stream")
 		c.Writer.Header().Set("Cache-Control", "no-cache")
 		c.Writer.Header().Set("Connection", "keep-alive")
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Flush()
 
 		ctx := c.Request.Context()
-		ticker := time.NewTicker(time.Second)
-		defer ticker.Stop()
+		// 写超时：对端停止读取时不会永久阻塞在 Write 上
+		rc := http.NewResponseController(c.Writer)
+		// 定期发送注释行，防止反向代理因空闲断开连接
+		keepalive := time.NewTicker(15 * time.Second)
+		defer keepalive.Stop()
 
 		for {
 			select {
 			case <-ctx.Done():
 				return
-			case <-ticker.C:
-				metrics.Mu.RLock()
-				data := metrics.Latest
-				metrics.Mu.RUnlock()
-				b, _ := json.Marshal(data)
-				fmt.Fprintf(c.Writer, "event: dashboard\n")
-				fmt.Fprintf(c.Writer, "data: %s\n\n", string(b))
+			case <-sub.Done():
+				return // 读取过慢被断开，浏览器会自动重连
+			case msg := <-sub.C():
+				_ = rc.SetWriteDeadline(time.Now().Add(10 * time.Second))
+				if _, err := c.Writer.Write(msg.SSE()); err != nil {
+					return
+				}
+				c.Writer.Flush()
+			case <-keepalive.C:
+				_ = rc.SetWriteDeadline(time.Now().Add(10 * time.Second))
+				fmt.Fprint(c.Writer, ": keepalive\n\n")
 				c.Writer.Flush()
 			}
 		}
 	})
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	api.GET("/ws", func(c *gin.Context) {
+		p := currentPrincipal(c)
+		audit := p.Role.Allows(auth.RoleOperator)
+		topics := make([]string, 0, len(stream.Topics))
+		if v, ok := c.GetQuery("topics"); ok {
+			var err error
+			if topics, err = stream.ParseTopics(v); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			for _, t := range topics {
+				if stream.AuditTopic(t) && !audit {
+					c.JSON(http.StatusForbidden, gin.H{"error": "topic " + t + " requires role operator"})
+					return
+				}
+			}
+		} else {
+			// 默认订阅当前角色可见的全部主题
+			for _, t := range stream.Topics {
+				if audit || !stream.AuditTopic(t) {
+					topics = append(topics, t)
+				}
+			}
+		}
+		lastID := c.GetHeader("Last-Event-ID")
+		if lastID == "" {
+			lastID = c.Query("last_event_id")
+		}
+		stream.ServeWS(c.Writer, c.Request, topics, lastID, stream.Permissions{
+			Username: p.Username,
+			Audit:    audit,
+			Ack:      p.Role.Allows(auth.RoleOperator),
+			Rescan:   p.Role.Allows(auth.RoleAdmin),
+		})
+	})
+
+	sc := config.Current().Server
+	srv := &http.Server{Addr: ":" + strconv.Itoa(sc.Port), Handler: r}
+	if !sc.TLS.Enabled {
+		fmt.Printf("[INFO] Listening on http://%s\n", srv.Addr)
+		fmt.Println(srv.ListenAndServe())
+		return
+	}
+	cm, err := certs.NewManager(sc.TLS)
+	if err != nil {
+		fmt.Println("[FATAL] TLS:", err)
+		os.Exit(1)
+	}
+	srv.TLSConfig = cm.TLSConfig()
+	fmt.Printf("[INFO] Listening on https://%s\n", srv.Addr)
+	fmt.Println(srv.ListenAndServeTLS("", ""))
+}
+
+const (
+	sessionCookie = "sysmon_session"
+	principalKey  = "principal"
+)
+
+// requireAuth 校验请求携带的会话 Token / API Token，认证关闭时直接放行
+func requireAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !auth.Enabled() {
+			c.Set(principalKey, auth.Principal{Role: auth.RoleAdmin, Method: "disabled"})
+			c.Next()
+			return
+		}
+		p, ok := auth.Authenticate(requestToken(c))
+		// 未携带 Token 时，接受已通过校验的客户端证书（mTLS）
+		if !ok && c.Request.TLS != nil && len(c.Request.TLS.VerifiedChains) > 0 {
+			p, ok = auth.AuthenticateCert(c.Request.TLS.VerifiedChains[0][0].Subject.CommonName)
+		}
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		c.Set(principalKey, p)
+		c.Next()
+	}
+}
+
+// requireRole 要求调用方至少拥有 role 角色，需放在 requireAuth 之后
+func requireRole(role auth.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !currentPrincipal(c).Role.Allows(role) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "requires role " + string(role)})
+			return
+		}
+		c.Next()
+	}
+}
+
+// dashboardFor 按角色过滤仪表盘数据：安全审计数据只对 operator 及以上可见
+func dashboardFor(p auth.Principal) metrics.DashboardData {
+	metrics.Mu.RLock()
+	data := metrics.Latest
+	metrics.Mu.RUnlock()
+	if !p.Role.Allows(auth.RoleOperator) {
+		data = data.WithoutAudit()
+	}
+	return data
+}
+
+// requestToken 依次从 Authorization 头与登录 Cookie 中读取 Token
+func requestToken(c *gin.Context) string {
+	if h := c.GetHeader("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		return strings.TrimPrefix(h, "Bearer ")
+	}
+	token, _ := c.Cookie(sessionCookie)
+	return token
+}
+
+func currentPrincipal(c *gin.Context) auth.Principal {
+	p, _ := c.Get(principalKey)
+	principal, _ := p.(auth.Principal)
+	return principal
+}
+
+func hashPassword() {
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		fmt.Fprintln(os.Stderr, "read password:", err)
+		os.Exit(1)
+	}
+	h, err := auth.HashPassword(strings.TrimRight(line, "\r\n"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Println(h)
+}
+
+// parseTimeParam 支持 Unix 秒或 RFC3339 格式，为空时返回默认值
+func parseTimeParam(v string, def time.Time) (time.Time, error) {
+	if v == "" {
+		return def, nil
+	}
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(n, 0), nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+// parseStepParam 支持 Go duration（如 "1m"）或秒数，最小 1 秒
+func parseStepParam(v string, def time.Duration) (time.Duration, error) {
+	step := def
+	if v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			step = time.Duration(n) * time.Second
+		} else if d, err := time.ParseDuration(v); err == nil {
+			step = d
+		} else {
+			return 0, err
+		}
+	}
+	if step < time.Second {
+		step = time.Second
 	}
-	r.Run(":" + port)
+	return step.Round(time.Second), nil
 }
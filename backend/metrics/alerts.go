@@ -0,0 +1,223 @@
+package metrics
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 告警生命周期：同一规则 + 同一实例持续触发只对应一个事件（incident），
+// 状态依次为 firing -> acknowledged（可选）-> resolved。
+
+const (
+	AlertFiring       = "firing"
+	AlertAcknowledged = "acknowledged"
+	AlertResolved     = "resolved"
+)
+
+var (
+	ErrAlertNotFound = errors.New("alert not found")
+	ErrAlertResolved = errors.New("alert already resolved")
+)
+
+// AlertEvent 在告警触发、确认、恢复时发出，供通知渠道订阅
+type AlertEvent struct {
+	Type  string    `json:"type"` // firing / acknowledged / resolved
+	Alert AlertInfo `json:"alert"`
+}
+
+var (
+	activeAlerts  = make(map[string]*AlertInfo) // fingerprint -> 未恢复的事件，受 Mu 保护
+	alertHandlers []func(AlertEvent)
+	// queuedAlertEvents 是采集协程之外产生的事件（如确认），受 Mu 保护，由下一次采集排在新事件之前发出
+	queuedAlertEvents []AlertEvent
+)
+
+// OnAlertEvent 注册告警事件回调，需在采集开始前调用。所有事件（包括 HTTP / WebSocket 上的确认）
+// 都由采集协程按状态变化的顺序同步发出，回调不会并发执行，但不应阻塞
+func OnAlertEvent(fn func(AlertEvent)) {
+	alertHandlers = append(alertHandlers, fn)
+}
+
+// takeQueuedAlertEvents 取出待发出的确认等事件，调用方需持有 Mu
+func takeQueuedAlertEvents() []AlertEvent {
+	events := queuedAlertEvents
+	queuedAlertEvents = nil
+	return events
+}
+
+func emitAlertEvents(events []AlertEvent) {
+	for _, ev := range events {
+		for _, fn := range alertHandlers {
+			fn(ev)
+		}
+	}
+}
+
+func alertFingerprint(a *AlertInfo) string {
+	return seriesKey(a.Rule, a.Labels)
+}
+
+func newAlertID(fingerprint string, start time.Time) string {
+	sum := sha1.Sum([]byte(fingerprint))
+	return hex.EncodeToString(sum[:4]) + "-" + strconv.FormatInt(start.Unix(), 36)
+}
+
+// updateIncidents 把本周期触发的告警合并进事件列表，调用方需持有 Mu 写锁。
+// 返回需要对外通知的状态变化。
+func updateIncidents(now time.Time, firing []AlertInfo, logCap int) []AlertEvent {
+	var events []AlertEvent
+	seen := make(map[string]bool, len(firing))
+	for _, f := range firing {
+		fp := alertFingerprint(&f)
+		seen[fp] = true
+		if a, ok := activeAlerts[fp]; ok {
+			a.LastSeen = now.Unix()
+			a.Count++
+			a.Value = f.Value
+			a.Text = f.Text
+			continue
+		}
+		a := f
+		a.ID = newAlertID(fp, now)
+		a.State = AlertFiring
+		a.StartsAt = now.Unix()
+		a.LastSeen = now.Unix()
+		a.Count = 1
+		activeAlerts[fp] = &a
+		alertLog = append(alertLog, &a)
+		alertsFired[a.Level]++
+		events = append(events, AlertEvent{Type: AlertFiring, Alert: a})
+	}
+	for fp, a := range activeAlerts {
+		if seen[fp] {
+			continue
+		}
+		a.State = AlertResolved
+		a.ResolvedAt = now.Unix()
+		delete(activeAlerts, fp)
+		events = append(events, AlertEvent{Type: AlertResolved, Alert: *a})
+	}
+	trimAlertLog(logCap)
+	return events
+}
+
+// trimAlertLog 超出容量时优先丢弃最早的已恢复事件
+func trimAlertLog(logCap int) {
+	over := len(alertLog) - logCap
+	if over <= 0 {
+		return
+	}
+	kept := alertLog[:0]
+	for _, a := range alertLog {
+		if over > 0 && a.State == AlertResolved {
+			over--
+			continue
+		}
+		kept = append(kept, a)
+	}
+	alertLog = kept
+	if len(alertLog) > logCap {
+		alertLog = alertLog[len(alertLog)-logCap:]
+	}
+}
+
+// alertSnapshot 复制事件列表供 DashboardData 使用，调用方需持有 Mu
+func alertSnapshot() (all, current []AlertInfo) {
+	all = make([]AlertInfo, 0, len(alertLog))
+	for _, a := range alertLog {
+		all = append(all, *a)
+		if a.State != AlertResolved {
+			current = append(current, *a)
+		}
+	}
+	return all, current
+}
+
+func matchState(a *AlertInfo, states []string) bool {
+	if len(states) == 0 {
+		return true
+	}
+	for _, s := range states {
+		if a.State == s {
+			return true
+		}
+	}
+	return false
+}
+
+// GetAlerts 分页返回告警事件，state 为逗号分隔的状态列表，为空时不过滤
+func GetAlerts(limit, offset int, state string) ([]AlertInfo, int) {
+	var states []string
+	for _, s := range strings.Split(state, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			states = append(states, s)
+		}
+	}
+
+	Mu.RLock()
+	defer Mu.RUnlock()
+	var filtered []*AlertInfo
+	for _, a := range alertLog {
+		if matchState(a, states) {
+			filtered = append(filtered, a)
+		}
+	}
+	total := len(filtered)
+	if limit <= 0 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > total {
+		offset = total
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+	items := make([]AlertInfo, 0, end-offset)
+	for _, a := range filtered[offset:end] {
+		items = append(items, *a)
+	}
+	return items, total
+}
+
+// AckAlert 确认一个仍在触发的告警；重复确认直接返回当前状态。
+// 确认事件交给采集协程在下一个周期发出，保证与触发 / 恢复事件的先后顺序一致
+func AckAlert(id, by string) (AlertInfo, error) {
+	Mu.Lock()
+	var found *AlertInfo
+	for _, a := range alertLog {
+		if a.ID == id {
+			found = a
+			break
+		}
+	}
+	if found == nil {
+		Mu.Unlock()
+		return AlertInfo{}, ErrAlertNotFound
+	}
+	if found.State == AlertResolved {
+		a := *found
+		Mu.Unlock()
+		return a, ErrAlertResolved
+	}
+	if found.State == AlertAcknowledged {
+		a := *found
+		Mu.Unlock()
+		return a, nil
+	}
+	found.State = AlertAcknowledged
+	found.AckedAt = time.Now().Unix()
+	found.AckedBy = by
+	a := *found
+	Latest.Alerts, Latest.Current = alertSnapshot()
+	queuedAlertEvents = append(queuedAlertEvents, AlertEvent{Type: AlertAcknowledged, Alert: a})
+	Mu.Unlock()
+	return a, nil
+}
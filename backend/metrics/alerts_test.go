@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// resetAlerts 清空告警状态，测试结束后恢复
+func resetAlerts(t *testing.T) {
+	t.Helper()
+	Mu.Lock()
+	prevActive, prevLog, prevQueued := activeAlerts, alertLog, queuedAlertEvents
+	activeAlerts, alertLog, queuedAlertEvents = make(map[string]*AlertInfo), nil, nil
+	Mu.Unlock()
+	t.Cleanup(func() {
+		Mu.Lock()
+		activeAlerts, alertLog, queuedAlertEvents = prevActive, prevLog, prevQueued
+		Mu.Unlock()
+	})
+}
+
+func TestAckAlertEventOrder(t *testing.T) {
+	resetAlerts(t)
+	now := time.Now()
+	firing := []AlertInfo{{Rule: "cpu", Level: "warn", Text: "CPU 使用率过高"}}
+	Mu.Lock()
+	events := append(takeQueuedAlertEvents(), updateIncidents(now, firing, 10)...)
+	Mu.Unlock()
+	if len(events) != 1 || events[0].Type != AlertFiring {
+		t.Fatalf("events = %+v", events)
+	}
+	id := events[0].Alert.ID
+
+	if _, err := AckAlert("nope", "alice"); !errors.Is(err, ErrAlertNotFound) {
+		t.Errorf("unknown id err = %v", err)
+	}
+	// HTTP 与 WebSocket 可能同时确认：只记录一次，事件交给采集协程
+	var wg sync.WaitGroup
+	for _, by := range []string{"alice", "bob", "carol"} {
+		wg.Add(1)
+		go func(by string) {
+			defer wg.Done()
+			if a, err := AckAlert(id, by); err != nil || a.State != AlertAcknowledged {
+				t.Errorf("AckAlert(%s) = %+v, %v", by, a, err)
+			}
+		}(by)
+	}
+	wg.Wait()
+
+	// 下一个周期告警恢复：确认事件排在恢复事件之前
+	Mu.Lock()
+	events = append(takeQueuedAlertEvents(), updateIncidents(now.Add(time.Second), nil, 10)...)
+	Mu.Unlock()
+	if len(events) != 2 || events[0].Type != AlertAcknowledged || events[1].Type != AlertResolved {
+		t.Fatalf("events = %+v", events)
+	}
+	if events[0].Alert.AckedBy == "" || events[1].Alert.AckedBy != events[0].Alert.AckedBy {
+		t.Errorf("acked_by = %q / %q", events[0].Alert.AckedBy, events[1].Alert.AckedBy)
+	}
+
+	if _, err := AckAlert(id, "alice"); !errors.Is(err, ErrAlertResolved) {
+		t.Errorf("ack resolved err = %v", err)
+	}
+	Mu.Lock()
+	defer Mu.Unlock()
+	if q := takeQueuedAlertEvents(); len(q) != 0 {
+		t.Errorf("queued after resolved = %+v", q)
+	}
+}
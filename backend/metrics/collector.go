@@ -2,10 +2,8 @@ package metrics
 
 import (
 	"fmt"
-	"os"
 	"path/filepath"
 	"runtime"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -22,19 +20,6 @@ import (
 	"github.com/shirou/gopsutil/v3/process"
 )
 
-func init() {
-	// 尝试从环境变量设置 gopsutil 的宿主机路径
-	if v := os.Getenv("HOST_PROC"); v != "" {
-		os.Setenv("HOST_PROC", v) // 确保 gopsutil 能读取到
-	}
-	if v := os.Getenv("HOST_SYS"); v != "" {
-		os.Setenv("HOST_SYS", v)
-	}
-	if v := os.Getenv("HOST_ETC"); v != "" {
-		os.Setenv("HOST_ETC", v)
-	}
-}
-
 type DashboardData struct {
 	CPU       CPUInfo       `json:"cpu"`
 	Memory    MemoryInfo    `json:"memory"`
@@ -42,13 +27,35 @@ type DashboardData struct {
 	Network   []NetworkInfo `json:"network"`
 	System    SystemInfo    `json:"system"`
 	Perf      PerfInfo      `json:"perf"`
-	Alerts    []AlertInfo   `json:"alerts"`         // 历史告警日志
-	Current   []AlertInfo   `json:"current_alerts"` // 当前采样周期内的告警
+	Alerts    []AlertInfo   `json:"alerts"`         // 告警事件日志（含已恢复）
+	Current   []AlertInfo   `json:"current_alerts"` // 尚未恢复的告警
 	NetLog    []NetLogEntry `json:"net_log"`        // 网络流量日志
 	GeoHeat   []GeoPoint    `json:"geo_heat"`
 	Timestamp int64         `json:"timestamp"`
 }
 
+var (
+	collectHandlers []func(DashboardData)
+	netLogHandlers  []func(NetLogEntry)
+)
+
+// OnCollect 注册采集完成回调，每个采集周期调用一次；回调在采集协程中同步执行，不应阻塞
+func OnCollect(fn func(DashboardData)) {
+	collectHandlers = append(collectHandlers, fn)
+}
+
+// OnNetLog 注册网络审计日志回调，每追加一条日志调用一次（先于同周期的 OnCollect 回调）
+func OnNetLog(fn func(NetLogEntry)) {
+	netLogHandlers = append(netLogHandlers, fn)
+}
+
+// WithoutAudit 去掉安全审计数据（网络日志及其中的连接、地理分布），供无审计权限的角色使用
+func (d DashboardData) WithoutAudit() DashboardData {
+	d.NetLog = nil
+	d.GeoHeat = nil
+	return d
+}
+
 type CPUInfo struct {
 	Usage     float64   `json:"usage"`
 	PerCore   []float64 `json:"per_core"`
@@ -108,9 +115,20 @@ type PerfInfo struct {
 }
 
 type AlertInfo struct {
-	Level string `json:"level"` // ok / warn / critical
-	Text  string `json:"text"`  // 描述，例如 "CPU 使用率过高：95.2%"
-	Time  string `json:"time"`  // 触发时间，格式 HH:MM:SS
+	ID         string            `json:"id"`                    // 事件 ID，在整个生命周期内保持不变
+	State      string            `json:"state"`                 // firing / acknowledged / resolved
+	Level      string            `json:"level"`                 // ok / warn / critical
+	Text       string            `json:"text"`                  // 描述，例如 "CPU 使用率过高：95.2%"
+	Time       string            `json:"time"`                  // 首次触发时间，格式 HH:MM:SS
+	Rule       string            `json:"rule,omitempty"`        // 触发的规则名
+	Labels     map[string]string `json:"labels,omitempty"`      // 规则标签 + 实例标签（path / interface）
+	Value      float64           `json:"value"`                 // 最近一次的指标值
+	StartsAt   int64             `json:"starts_at"`             // 首次触发（Unix 秒）
+	LastSeen   int64             `json:"last_seen"`             // 最近一次满足条件
+	ResolvedAt int64             `json:"resolved_at,omitempty"` // 恢复时间
+	AckedAt    int64             `json:"acked_at,omitempty"`    // 确认时间
+	AckedBy    string            `json:"acked_by,omitempty"`
+	Count      int               `json:"count"` // 持续触发的采集周期数
 }
 
 // NetLogEntry 表示一条网络流量日志（含安全审计信息）
@@ -123,14 +141,16 @@ type NetLogEntry struct {
 }
 
 type ConnectionInfo struct {
-	RemoteIP   string `json:"remote_ip"`
-	RemotePort uint32 `json:"remote_port"`
-	LocalPort  uint32 `json:"local_port"`
-	Protocol   string `json:"protocol"` // TCP/UDP
-	Status     string `json:"status"`   // ESTABLISHED, etc
-	Process    string `json:"process"`  // Process Name
-	Country    string `json:"country"`
-	City       string `json:"city"`
+	RemoteIP   string   `json:"remote_ip"`
+	RemotePort uint32   `json:"remote_port"`
+	LocalPort  uint32   `json:"local_port"`
+	Protocol   string   `json:"protocol"` // TCP/UDP
+	Status     string   `json:"status"`   // ESTABLISHED, etc
+	Process    string   `json:"process"`  // Process Name
+	PID        int32    `json:"pid"`
+	Ancestry   []string `json:"ancestry,omitempty"` // 进程链，从自身到顶层祖先，如 ["bash(4300)", "sshd(812)", "systemd(1)"]
+	Country    string   `json:"country"`
+	City       string   `json:"city"`
 }
 
 type GeoPoint struct {
@@ -149,39 +169,29 @@ var (
 	lastNetIO  map[string]net.IOCountersStat
 	lastTime   time.Time
 
-	alertLog   []AlertInfo
+	alertLog   []*AlertInfo
 	netLog     []NetLogEntry
 	logCounter int
-)
 
-var geoReader *geoip2.Reader
-
-type Config struct {
-	CPUWarn float64
-	MemWarn float64
-}
+	// 供 /metrics 导出的原始计数器与累计告警数，受 Mu 保护
+	rawDiskIO   map[string]disk.IOCountersStat
+	rawNetIO    map[string]net.IOCountersStat
+	alertsFired = make(map[string]uint64)
+)
 
-var cfg Config
+var (
+	geoReader *geoip2.Reader
+	geoPath   string // 当前已加载的 GeoIP 数据库路径，仅采集协程访问
+)
 
-func InitConfigFromEnv() {
-	cfg.CPUWarn = 80
-	cfg.MemWarn = 90
-	if v := os.Getenv("ALERT_CPU_WARN"); v != "" {
-		if f, err := strconv.ParseFloat(v, 64); err == nil {
-			cfg.CPUWarn = f
-		}
-	}
-	if v := os.Getenv("ALERT_MEM_WARN"); v != "" {
-		if f, err := strconv.ParseFloat(v, 64); err == nil {
-			cfg.MemWarn = f
-		}
+func InitGeo(path string) {
+	geoPath = path
+	if geoReader != nil {
+		geoReader.Close()
+		geoReader = nil
 	}
-}
-
-func InitGeo() {
-	path := os.Getenv("GEOIP_DB_PATH")
 	if path == "" {
-		fmt.Println("[WARN] GEOIP_DB_PATH is not set. Geo features disabled.")
+		fmt.Println("[WARN] geoip_db_path (GEOIP_DB_PATH) is not set. Geo features disabled.")
 		return
 	}
 	r, err := geoip2.Open(path)
@@ -193,9 +203,15 @@ func InitGeo() {
 	geoReader = r
 }
 
+// StartCollector 按当前配置启动采集协程，调用前应先通过 Apply 应用配置
 func StartCollector() {
-	InitConfigFromEnv()
-	InitGeo()
+	cfgMu.Lock()
+	started = true
+	c := cfg
+	cfgMu.Unlock()
+
+	InitGeo(c.GeoIPPath)
+	InitHistory(c.History)
 	lastTime = time.Now()
 	lastDiskIO, _ = disk.IOCounters()
 	lastNetIO = netSliceToMap() // 🔥 正确初始化
@@ -203,7 +219,7 @@ func StartCollector() {
 	go func() {
 		for {
 			collect()
-			time.Sleep(time.Second)
+			time.Sleep(currentConfig().Interval)
 		}
 	}()
 }
@@ -245,6 +261,10 @@ func shouldIgnorePartition(p disk.PartitionStat) bool {
 func collect() {
 	// debug logging
 	// fmt.Println("Start collect...")
+	c := currentConfig()
+	if c.GeoIPPath != geoPath {
+		InitGeo(c.GeoIPPath)
+	}
 	now := time.Now()
 	delta := now.Sub(lastTime).Seconds()
 	if delta <= 0 {
@@ -277,7 +297,7 @@ func collect() {
 	newDiskIO, _ := disk.IOCounters()
 
 	var disks []DiskInfo
-	hostRoot := os.Getenv("HOST_ROOT")
+	hostRoot := c.Host.Root
 	var totalDiskRead, totalDiskWrite float64
 	for _, p := range partitions {
 		// 在 Docker 中，如果 partitions 读取的是宿主机的 mounts (如 /mnt/c)，
@@ -329,11 +349,13 @@ func collect() {
 
 	var nets []NetworkInfo
 	var totalRx, totalTx float64
+	netRaw := make(map[string]net.IOCountersStat)
 	for name, cur := range newNet {
 		// 过滤掉 docker, veth, br-, lo 等虚拟网卡
 		if name == "lo" || strings.HasPrefix(name, "docker") || strings.HasPrefix(name, "veth") || strings.HasPrefix(name, "br-") {
 			continue
 		}
+		netRaw[name] = cur
 
 		if old, ok := lastNetIO[name]; ok {
 			rx := float64(cur.BytesRecv-old.BytesRecv) / 1024 / delta
@@ -352,11 +374,11 @@ func collect() {
 	hostStat, _ := host.Info()
 	procs, _ := process.Pids()
 	// 如果在 Docker 中，尝试读取宿主机的主机名（如果通过环境变量传递）
-	if v := os.Getenv("HOST_HOSTNAME"); v != "" {
-		hostStat.Hostname = v
+	if c.Host.Hostname != "" {
+		hostStat.Hostname = c.Host.Hostname
 	}
-	if v := os.Getenv("HOST_OS"); v != "" {
-		hostStat.OS = v
+	if c.Host.OS != "" {
+		hostStat.OS = c.Host.OS
 	}
 
 	// Sensors
@@ -393,52 +415,33 @@ func collect() {
 	}
 
 	// Alerts
-	var alerts []AlertInfo
-	if perf.CPUUsage > cfg.CPUWarn {
-		alerts = append(alerts, AlertInfo{
-			Level: "warn",
-			Text:  fmt.Sprintf("CPU 使用率过高：%.1f%%", perf.CPUUsage),
-			Time:  now.Format("15:04:05"),
-		})
-	}
-	if perf.MemUsedPercent > cfg.MemWarn {
-		alerts = append(alerts, AlertInfo{
-			Level: "warn",
-			Text:  fmt.Sprintf("内存使用率过高：%.1f%%", perf.MemUsedPercent),
-			Time:  now.Format("15:04:05"),
-		})
-	}
-
-	if len(alerts) > 0 {
-		alertLog = append(alertLog, alerts...)
-		if len(alertLog) > 200 {
-			alertLog = alertLog[len(alertLog)-200:]
-		}
-	}
+	firing := evaluateRules(now, perf, disks, nets)
 
 	// NetLog
 	logCounter++
 	shouldLog := false
-	if totalRx+totalTx > 100 {
+	if totalRx+totalTx > c.NetLogTriggerKBps {
 		shouldLog = true
 	}
-	if logCounter >= 10 {
+	if logCounter >= c.NetLogEvery {
 		shouldLog = true
 		logCounter = 0
 	}
 
+	var newEntry *NetLogEntry
 	if shouldLog {
-		auditConns := collectAuditConnections()
-		if len(auditConns) > 0 || totalRx+totalTx > 100 {
-			netLog = append(netLog, NetLogEntry{
+		auditConns := collectAuditConnections(indexProcesses(processSnapshot()), c.MaxConnections)
+		if len(auditConns) > 0 || totalRx+totalTx > c.NetLogTriggerKBps {
+			newEntry = &NetLogEntry{
 				Time:        now.Format("15:04:05"),
 				Rx:          totalRx,
 				Tx:          totalTx,
 				Interfaces:  nets,
 				Connections: auditConns,
-			})
-			if len(netLog) > 300 {
-				netLog = netLog[len(netLog)-300:]
+			}
+			netLog = append(netLog, *newEntry)
+			if len(netLog) > c.NetLogCap {
+				netLog = netLog[len(netLog)-c.NetLogCap:]
 			}
 		}
 	}
@@ -452,6 +455,9 @@ func collect() {
 	// Update global data
 	Mu.Lock()
 
+	alertEvents := append(takeQueuedAlertEvents(), updateIncidents(now, firing, c.AlertLogCap)...)
+	alerts, current := alertSnapshot()
+
 	cores := 0
 	modelName := ""
 	mhz := 0.0
@@ -466,7 +472,7 @@ func collect() {
 		modelName = "Unknown CPU"
 	}
 
-	Latest = DashboardData{
+	data := DashboardData{
 		CPU: CPUInfo{
 			Usage:     usageVal,
 			PerCore:   perCore,
@@ -489,42 +495,34 @@ func collect() {
 		Network:   nets,
 		System:    SystemInfo{Hostname: hostStat.Hostname, OS: hostStat.OS, Platform: hostStat.Platform, BootTime: hostStat.BootTime, Procs: len(procs)},
 		Perf:      perf,
-		Alerts:    alertLog,
-		Current:   alerts,
+		Alerts:    alerts,
+		Current:   current,
 		NetLog:    netLog,
 		GeoHeat:   geoPoints,
 		Timestamp: now.Unix(),
 	}
+	Latest = data
+	rawDiskIO = newDiskIO
+	rawNetIO = netRaw
 	Mu.Unlock()
 
+	emitAlertEvents(alertEvents)
+	recordHistory(&data)
+	if newEntry != nil {
+		for _, fn := range netLogHandlers {
+			fn(*newEntry)
+		}
+	}
+	for _, fn := range collectHandlers {
+		fn(data)
+	}
+
 	lastNetIO = newNet
 	lastDiskIO = newDiskIO
 	lastTime = now
 	// fmt.Println("End collect")
 }
 
-func GetAlerts(limit, offset int) ([]AlertInfo, int) {
-	Mu.RLock()
-	defer Mu.RUnlock()
-	total := len(alertLog)
-	if limit <= 0 {
-		limit = 20
-	}
-	if offset < 0 {
-		offset = 0
-	}
-	if offset > total {
-		offset = total
-	}
-	end := offset + limit
-	if end > total {
-		end = total
-	}
-	items := make([]AlertInfo, end-offset)
-	copy(items, alertLog[offset:end])
-	return items, total
-}
-
 func isPrivateIP(ip string) bool {
 	p := stdnet.ParseIP(ip)
 	if p == nil {
@@ -549,15 +547,15 @@ func isPrivateIP(ip string) bool {
 	return false
 }
 
-func collectAuditConnections() []ConnectionInfo {
+func collectAuditConnections(procIdx map[int32]*ProcessInfo, maxConns int) []ConnectionInfo {
 	conns, err := net.Connections("inet")
 	if err != nil {
 		return nil
 	}
 
 	var out []ConnectionInfo
-	// Cache for pid -> name to avoid duplicate lookups in same batch
-	procNames := make(map[int32]string)
+	// Cache for pid -> ancestry to avoid duplicate lookups in same batch
+	chains := make(map[int32][]ProcessInfo)
 
 	for _, c := range conns {
 		// 只关注 ESTABLISHED 且有远程地址的
@@ -568,18 +566,15 @@ func collectAuditConnections() []ConnectionInfo {
 			continue
 		}
 
-		// Process Name
-		name, ok := procNames[c.Pid]
+		// Process Name + 父进程链
+		chain, ok := chains[c.Pid]
 		if !ok {
-			if c.Pid > 0 {
-				if p, err := process.NewProcess(c.Pid); err == nil {
-					name, _ = p.Name()
-				}
-			}
-			if name == "" {
-				name = "unknown"
-			}
-			procNames[c.Pid] = name
+			chain = ancestryFrom(procIdx, c.Pid)
+			chains[c.Pid] = chain
+		}
+		name := "unknown"
+		if len(chain) > 0 && chain[0].Name != "" {
+			name = chain[0].Name
 		}
 
 		// Geo
@@ -611,11 +606,13 @@ func collectAuditConnections() []ConnectionInfo {
 			Protocol:   proto,
 			Status:     c.Status,
 			Process:    name,
+			PID:        c.Pid,
+			Ancestry:   ancestryNames(chain),
 			Country:    country,
 			City:       city,
 		})
 
-		if len(out) >= 20 { // Limit max entries per snapshot to avoid bloat
+		if len(out) >= maxConns { // Limit max entries per snapshot to avoid bloat
 			break
 		}
 	}
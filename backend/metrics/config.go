@@ -0,0 +1,135 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// HostConfig 用于在容器中读取宿主机信息，对应 docker-compose.yml 中的 HOST_* 变量
+type HostConfig struct {
+	Proc     string `yaml:"proc,omitempty"`     // 宿主机 /proc 挂载点（HOST_PROC）
+	Sys      string `yaml:"sys,omitempty"`      // 宿主机 /sys 挂载点（HOST_SYS）
+	Etc      string `yaml:"etc,omitempty"`      // 宿主机 /etc 挂载点（HOST_ETC）
+	Root     string `yaml:"root,omitempty"`     // 宿主机根目录挂载点，用于计算分区用量（HOST_ROOT）
+	Hostname string `yaml:"hostname,omitempty"` // 覆盖上报的主机名（HOST_HOSTNAME）
+	OS       string `yaml:"os,omitempty"`       // 覆盖上报的操作系统（HOST_OS）
+}
+
+type Config struct {
+	Interval          time.Duration `yaml:"interval"`            // 采集周期
+	CPUWarn           float64       `yaml:"cpu_warn"`            // 内置 CPU 规则阈值（未配置 rules 时生效）
+	MemWarn           float64       `yaml:"mem_warn"`            // 内置内存规则阈值（未配置 rules 时生效）
+	AlertLogCap       int           `yaml:"alert_log_cap"`       // 告警事件保留条数
+	NetLogCap         int           `yaml:"netlog_cap"`          // 网络审计日志保留条数
+	NetLogTriggerKBps float64       `yaml:"netlog_trigger_kbps"` // 上下行合计超过该值时立即记录审计快照
+	NetLogEvery       int           `yaml:"netlog_every"`        // 无突发流量时每隔多少个周期记录一次
+	MaxConnections    int           `yaml:"max_connections"`     // 每个审计快照最多记录的连接数
+	GeoIPPath         string        `yaml:"geoip_db_path"`       // GeoIP 数据库路径，为空时关闭地理解析
+	Host              HostConfig    `yaml:"host"`
+	History           HistoryConfig `yaml:"history"`
+	Rules             []AlertRule   `yaml:"rules"` // 为空时使用基于 cpu_warn / mem_warn 的内置规则
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Interval:          time.Second,
+		CPUWarn:           80,
+		MemWarn:           90,
+		AlertLogCap:       200,
+		NetLogCap:         300,
+		NetLogTriggerKBps: 100,
+		NetLogEvery:       10,
+		MaxConnections:    20,
+		History:           defaultHistoryConfig(),
+	}
+}
+
+var (
+	cfgMu   sync.RWMutex
+	cfg     = DefaultConfig()
+	started bool
+)
+
+func currentConfig() Config {
+	cfgMu.RLock()
+	defer cfgMu.RUnlock()
+	return cfg
+}
+
+// GetConfig 返回当前生效的采集配置
+func GetConfig() Config {
+	return currentConfig()
+}
+
+func (c Config) Validate() error {
+	if c.Interval < 100*time.Millisecond {
+		return errors.New("interval must be at least 100ms")
+	}
+	if c.CPUWarn <= 0 || c.CPUWarn > 100 {
+		return errors.New("cpu_warn must be in (0, 100]")
+	}
+	if c.MemWarn <= 0 || c.MemWarn > 100 {
+		return errors.New("mem_warn must be in (0, 100]")
+	}
+	if c.AlertLogCap <= 0 || c.NetLogCap <= 0 {
+		return errors.New("alert_log_cap and netlog_cap must be positive")
+	}
+	if c.NetLogTriggerKBps < 0 {
+		return errors.New("netlog_trigger_kbps must not be negative")
+	}
+	if c.NetLogEvery <= 0 || c.MaxConnections <= 0 {
+		return errors.New("netlog_every and max_connections must be positive")
+	}
+	h := c.History
+	if h.RawRetention < 0 || h.Retention1m < 0 || h.Retention5m < 0 || h.Retention1h < 0 {
+		return errors.New("history retention must not be negative")
+	}
+	if _, err := compileRules(c.effectiveRules()); err != nil {
+		return fmt.Errorf("rules: %w", err)
+	}
+	return nil
+}
+
+func (c Config) effectiveRules() []AlertRule {
+	if len(c.Rules) == 0 {
+		return defaultAlertRules(c)
+	}
+	return c.Rules
+}
+
+// Apply 校验并应用新配置，可在运行中重复调用（配置热加载）
+func Apply(c Config) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	compiled, _ := compileRules(c.effectiveRules())
+
+	// gopsutil 每次调用都会读取这些环境变量
+	setEnvIfNotEmpty("HOST_PROC", c.Host.Proc)
+	setEnvIfNotEmpty("HOST_SYS", c.Host.Sys)
+	setEnvIfNotEmpty("HOST_ETC", c.Host.Etc)
+
+	cfgMu.Lock()
+	cfg = c
+	running := started
+	cfgMu.Unlock()
+
+	rulesMu.Lock()
+	rules = compiled
+	rulesMu.Unlock()
+
+	// GeoIP 路径变化由采集协程在下一周期处理，避免并发替换 geoReader
+	if running && history != nil {
+		history.setRetention(c.History)
+	}
+	return nil
+}
+
+func setEnvIfNotEmpty(name, v string) {
+	if v != "" {
+		os.Setenv(name, v)
+	}
+}
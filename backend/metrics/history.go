@@ -0,0 +1,512 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// 历史时序存储：每个采集周期写入一次原始样本，同时累积到 1m/5m/1h 降采样桶中。
+// 数据保存在本地 bbolt 文件里，后端重启后仍然可以回看之前的数据。
+
+type HistoryConfig struct {
+	Path         string        `yaml:"path"`          // 数据文件路径，为空时关闭历史存储（修改后需重启）
+	RawRetention time.Duration `yaml:"retention_raw"` // 原始（秒级）样本保留时长，0 表示不清理
+	Retention1m  time.Duration `yaml:"retention_1m"`  // 1 分钟汇总保留时长
+	Retention5m  time.Duration `yaml:"retention_5m"`  // 5 分钟汇总保留时长
+	Retention1h  time.Duration `yaml:"retention_1h"`  // 1 小时汇总保留时长
+}
+
+type resolution struct {
+	Name string
+	Step time.Duration
+}
+
+// 按粒度从细到粗排列，查询时据此选择合适的数据源
+var resolutions = []resolution{
+	{Name: "raw", Step: time.Second},
+	{Name: "1m", Step: time.Minute},
+	{Name: "5m", Step: 5 * time.Minute},
+	{Name: "1h", Step: time.Hour},
+}
+
+var seriesBucket = []byte("series") // 序列元数据：key -> {metric, labels}
+
+type historySample struct {
+	Metric string
+	Labels map[string]string
+	Value  float64
+}
+
+// aggPoint 是一个时间桶内的聚合值；原始样本 Count 为 1
+type aggPoint struct {
+	Min   float64
+	Max   float64
+	Sum   float64
+	Count uint64
+}
+
+type seriesMeta struct {
+	Metric string            `json:"metric"`
+	Labels map[string]string `json:"labels"`
+}
+
+type historyStore struct {
+	db        *bolt.DB
+	cfg       HistoryConfig
+	mu        sync.Mutex
+	known     map[string]bool
+	lastPrune time.Time
+}
+
+var history *historyStore
+
+func defaultHistoryConfig() HistoryConfig {
+	return HistoryConfig{
+		Path:         "history.db",
+		RawRetention: 6 * time.Hour,
+		Retention1m:  7 * 24 * time.Hour,
+		Retention5m:  30 * 24 * time.Hour,
+		Retention1h:  365 * 24 * time.Hour,
+	}
+}
+
+func InitHistory(hc HistoryConfig) {
+	if hc.Path == "" {
+		fmt.Println("[WARN] history.path is empty. History store disabled.")
+		return
+	}
+	s, err := openHistory(hc)
+	if err != nil {
+		fmt.Printf("[ERROR] Failed to open history DB at %s: %v\n", hc.Path, err)
+		return
+	}
+	fmt.Printf("[INFO] History DB opened at %s\n", hc.Path)
+	history = s
+}
+
+func openHistory(hc HistoryConfig) (*historyStore, error) {
+	db, err := bolt.Open(hc.Path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(seriesBucket); err != nil {
+			return err
+		}
+		for _, r := range resolutions {
+			if _, err := tx.CreateBucketIfNotExists([]byte(r.Name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &historyStore{db: db, cfg: hc, known: make(map[string]bool)}, nil
+}
+
+func (s *historyStore) setRetention(hc HistoryConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if hc.Path != s.cfg.Path {
+		fmt.Println("[WARN] history.path changed, restart the backend to switch history DB.")
+	}
+	hc.Path = s.cfg.Path
+	s.cfg = hc
+}
+
+func (r resolution) retention(hc HistoryConfig) time.Duration {
+	switch r.Name {
+	case "raw":
+		return hc.RawRetention
+	case "1m":
+		return hc.Retention1m
+	case "5m":
+		return hc.Retention5m
+	case "1h":
+		return hc.Retention1h
+	}
+	return 0
+}
+
+// seriesKey 生成形如 disk_read_kbps{path="/"} 的序列标识，标签按键名排序
+func seriesKey(metric string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return metric
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(metric)
+	b.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(labels[k]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func timeKey(t time.Time, step time.Duration) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, uint64(t.Truncate(step).Unix()))
+	return k
+}
+
+func (p aggPoint) encode() []byte {
+	b := make([]byte, 32)
+	binary.BigEndian.PutUint64(b[0:], math.Float64bits(p.Min))
+	binary.BigEndian.PutUint64(b[8:], math.Float64bits(p.Max))
+	binary.BigEndian.PutUint64(b[16:], math.Float64bits(p.Sum))
+	binary.BigEndian.PutUint64(b[24:], p.Count)
+	return b
+}
+
+func decodeAggPoint(b []byte) (aggPoint, bool) {
+	if len(b) != 32 {
+		return aggPoint{}, false
+	}
+	return aggPoint{
+		Min:   math.Float64frombits(binary.BigEndian.Uint64(b[0:])),
+		Max:   math.Float64frombits(binary.BigEndian.Uint64(b[8:])),
+		Sum:   math.Float64frombits(binary.BigEndian.Uint64(b[16:])),
+		Count: binary.BigEndian.Uint64(b[24:]),
+	}, true
+}
+
+func (p *aggPoint) add(v float64) {
+	if p.Count == 0 || v < p.Min {
+		p.Min = v
+	}
+	if p.Count == 0 || v > p.Max {
+		p.Max = v
+	}
+	p.Sum += v
+	p.Count++
+}
+
+func (p *aggPoint) merge(o aggPoint) {
+	if o.Count == 0 {
+		return
+	}
+	if p.Count == 0 || o.Min < p.Min {
+		p.Min = o.Min
+	}
+	if p.Count == 0 || o.Max > p.Max {
+		p.Max = o.Max
+	}
+	p.Sum += o.Sum
+	p.Count += o.Count
+}
+
+// Append 在一个事务内写入本周期所有样本；各级汇总桶直接读改写，
+// 因此重启后未写满的桶也能继续累积。
+func (s *historyStore) Append(ts time.Time, samples []historySample) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		meta := tx.Bucket(seriesBucket)
+		for _, smp := range samples {
+			if math.IsNaN(smp.Value) || math.IsInf(smp.Value, 0) {
+				continue
+			}
+			key := seriesKey(smp.Metric, smp.Labels)
+			if !s.known[key] {
+				b, _ := json.Marshal(seriesMeta{Metric: smp.Metric, Labels: smp.Labels})
+				if err := meta.Put([]byte(key), b); err != nil {
+					return err
+				}
+			}
+			for _, r := range resolutions {
+				sb, err := tx.Bucket([]byte(r.Name)).CreateBucketIfNotExists([]byte(key))
+				if err != nil {
+					return err
+				}
+				tk := timeKey(ts, r.Step)
+				p, _ := decodeAggPoint(sb.Get(tk))
+				p.add(smp.Value)
+				if err := sb.Put(tk, p.encode()); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, smp := range samples {
+		s.known[seriesKey(smp.Metric, smp.Labels)] = true
+	}
+	if ts.Sub(s.lastPrune) >= 5*time.Minute {
+		s.lastPrune = ts
+		return s.pruneLocked(ts)
+	}
+	return nil
+}
+
+// pruneLocked 删除超出各级保留时长的数据点，保留时长为 0 表示不清理
+func (s *historyStore) pruneLocked(now time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, r := range resolutions {
+			ret := r.retention(s.cfg)
+			if ret <= 0 {
+				continue
+			}
+			cutoff := timeKey(now.Add(-ret), r.Step)
+			root := tx.Bucket([]byte(r.Name))
+			var series [][]byte
+			root.ForEach(func(k, v []byte) error {
+				if v == nil {
+					series = append(series, append([]byte(nil), k...))
+				}
+				return nil
+			})
+			for _, name := range series {
+				sb := root.Bucket(name)
+				// bbolt 游标在 Delete 后再 Next 会跳过元素，先收集再删除
+				var stale [][]byte
+				c := sb.Cursor()
+				for k, _ := c.First(); k != nil && bytes.Compare(k, cutoff) < 0; k, _ = c.Next() {
+					stale = append(stale, append([]byte(nil), k...))
+				}
+				for _, k := range stale {
+					if err := sb.Delete(k); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// historySamples 把一次采集结果展开成需要持久化的样本
+func historySamples(d *DashboardData) []historySample {
+	out := []historySample{
+		{Metric: "cpu_usage", Value: d.Perf.CPUUsage},
+		{Metric: "load1", Value: d.Perf.Load1},
+		{Metric: "load5", Value: d.Perf.Load5},
+		{Metric: "load15", Value: d.Perf.Load15},
+		{Metric: "mem_used_percent", Value: d.Memory.UsedPercent},
+		{Metric: "mem_used", Value: float64(d.Memory.Used)},
+		{Metric: "swap_used", Value: float64(d.Memory.SwapUsed)},
+		{Metric: "cpu_temp", Value: d.Perf.CPUTemp},
+		{Metric: "net_rx_kbps_total", Value: d.Perf.NetRxKBps},
+		{Metric: "net_tx_kbps_total", Value: d.Perf.NetTxKBps},
+		{Metric: "disk_read_kbps_total", Value: d.Perf.DiskReadKBps},
+		{Metric: "disk_write_kbps_total", Value: d.Perf.DiskWriteKBps},
+	}
+	for i, v := range d.CPU.PerCore {
+		out = append(out, historySample{Metric: "cpu_core_usage", Labels: map[string]string{"core": strconv.Itoa(i)}, Value: v})
+	}
+	for _, dk := range d.Disk {
+		l := map[string]string{"path": dk.Path}
+		out = append(out,
+			historySample{Metric: "disk_used_percent", Labels: l, Value: dk.UsedPercent},
+			historySample{Metric: "disk_read_kbps", Labels: l, Value: dk.ReadSpeed},
+			historySample{Metric: "disk_write_kbps", Labels: l, Value: dk.WriteSpeed},
+		)
+	}
+	for _, n := range d.Network {
+		l := map[string]string{"interface": n.Interface}
+		out = append(out,
+			historySample{Metric: "net_rx_kbps", Labels: l, Value: n.RX},
+			historySample{Metric: "net_tx_kbps", Labels: l, Value: n.TX},
+		)
+	}
+	return out
+}
+
+func recordHistory(d *DashboardData) {
+	if history == nil {
+		return
+	}
+	if err := history.Append(time.Unix(d.Timestamp, 0), historySamples(d)); err != nil {
+		fmt.Println("Error history.Append:", err)
+	}
+}
+
+var ErrHistoryDisabled = errors.New("history store is disabled")
+
+// deviceLabels 是按设备分序列的指标及区分设备的标签；整机汇总值使用带 _total 后缀的独立指标名
+var deviceLabels = map[string]string{
+	"cpu_core_usage":    "core",
+	"disk_used_percent": "path",
+	"disk_read_kbps":    "path",
+	"disk_write_kbps":   "path",
+	"net_rx_kbps":       "interface",
+	"net_tx_kbps":       "interface",
+}
+
+// HistoryLabelError 表示查询按设备分序列的指标时未指定设备标签
+type HistoryLabelError struct {
+	Metric, Label string
+}
+
+func (e *HistoryLabelError) Error() string {
+	return fmt.Sprintf("metric %s requires the %s label", e.Metric, e.Label)
+}
+
+type HistoryQuery struct {
+	Metric string
+	Labels map[string]string // 标签过滤，需全部匹配
+	Start  time.Time
+	End    time.Time
+	Step   time.Duration
+}
+
+type HistoryPoint struct {
+	T   int64   `json:"t"` // 对齐到 step 的桶起始时间（Unix 秒）
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+	Avg float64 `json:"avg"`
+}
+
+type HistorySeries struct {
+	Labels map[string]string `json:"labels"`
+	Points []HistoryPoint    `json:"points"`
+}
+
+type HistoryResult struct {
+	Metric     string          `json:"metric"`
+	Start      int64           `json:"start"`
+	End        int64           `json:"end"`
+	Step       int64           `json:"step"`       // 秒
+	Resolution string          `json:"resolution"` // 实际读取的存储粒度
+	Series     []HistorySeries `json:"series"`
+}
+
+// pickResolution 在保留时长仍覆盖查询起点的粒度中选择：能整除 step 的取最粗的（结果精度相同、读取量更小），
+// 否则取最细的再按 step 降采样；都不覆盖起点时使用保留最久的粒度
+func pickResolution(start, now time.Time, step time.Duration, hc HistoryConfig) resolution {
+	var covering []resolution
+	for _, r := range resolutions {
+		if ret := r.retention(hc); ret <= 0 || !start.Before(now.Add(-ret)) {
+			covering = append(covering, r)
+		}
+	}
+	if len(covering) == 0 {
+		best := resolutions[0]
+		for _, r := range resolutions {
+			if r.retention(hc) > best.retention(hc) {
+				best = r
+			}
+		}
+		return best
+	}
+	best := covering[0]
+	for _, r := range covering {
+		if r.Step <= step && step%r.Step == 0 {
+			best = r
+		}
+	}
+	return best
+}
+
+func labelsMatch(labels, filter map[string]string) bool {
+	for k, v := range filter {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func QueryHistory(q HistoryQuery) (*HistoryResult, error) {
+	if history == nil {
+		return nil, ErrHistoryDisabled
+	}
+	if label, ok := deviceLabels[q.Metric]; ok && q.Labels[label] == "" {
+		return nil, &HistoryLabelError{Metric: q.Metric, Label: label}
+	}
+	if q.Step < time.Second {
+		q.Step = time.Second
+	}
+	q.Step = q.Step.Truncate(time.Second)
+	start := q.Start.Truncate(q.Step)
+	history.mu.Lock()
+	hc := history.cfg
+	history.mu.Unlock()
+	res := pickResolution(start, time.Now(), q.Step, hc)
+
+	out := &HistoryResult{
+		Metric:     q.Metric,
+		Start:      start.Unix(),
+		End:        q.End.Unix(),
+		Step:       int64(q.Step / time.Second),
+		Resolution: res.Name,
+		Series:     []HistorySeries{},
+	}
+
+	err := history.db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte(res.Name))
+		return tx.Bucket(seriesBucket).ForEach(func(k, v []byte) error {
+			var meta seriesMeta
+			if err := json.Unmarshal(v, &meta); err != nil || meta.Metric != q.Metric {
+				return nil
+			}
+			if !labelsMatch(meta.Labels, q.Labels) {
+				return nil
+			}
+			sb := root.Bucket(k)
+			if sb == nil {
+				return nil
+			}
+
+			buckets := make(map[int64]*aggPoint)
+			var order []int64
+			endKey := timeKey(q.End, res.Step)
+			c := sb.Cursor()
+			for tk, tv := c.Seek(timeKey(start, res.Step)); tk != nil && bytes.Compare(tk, endKey) <= 0; tk, tv = c.Next() {
+				p, ok := decodeAggPoint(tv)
+				if !ok || p.Count == 0 {
+					continue
+				}
+				ts := time.Unix(int64(binary.BigEndian.Uint64(tk)), 0).Truncate(q.Step).Unix()
+				b, ok := buckets[ts]
+				if !ok {
+					b = &aggPoint{}
+					buckets[ts] = b
+					order = append(order, ts)
+				}
+				b.merge(p)
+			}
+
+			s := HistorySeries{Labels: meta.Labels, Points: make([]HistoryPoint, 0, len(order))}
+			if s.Labels == nil {
+				s.Labels = map[string]string{}
+			}
+			for _, ts := range order {
+				b := buckets[ts]
+				s.Points = append(s.Points, HistoryPoint{T: ts, Min: b.Min, Max: b.Max, Avg: b.Sum / float64(b.Count)})
+			}
+			out.Series = append(out.Series, s)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,199 @@
+package metrics
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPickResolution(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	hc := defaultHistoryConfig()
+	forever := HistoryConfig{}
+	short := HistoryConfig{RawRetention: time.Hour, Retention1m: 2 * time.Hour, Retention5m: 3 * time.Hour, Retention1h: 4 * time.Hour}
+	tests := []struct {
+		name  string
+		start time.Duration // 相对 now 的查询起点
+		step  time.Duration
+		hc    HistoryConfig
+		want  string
+	}{
+		{"recent 1s step", 10 * time.Minute, time.Second, hc, "raw"},
+		{"recent 1m step", 10 * time.Minute, time.Minute, hc, "1m"},
+		{"recent 10m step uses 5m", time.Hour, 10 * time.Minute, hc, "5m"},
+		{"recent step not divisible falls back to raw", time.Hour, 90 * time.Second, hc, "raw"},
+		{"24h beyond raw retention", 24 * time.Hour, time.Second, hc, "1m"},
+		{"24h 1h step", 24 * time.Hour, time.Hour, hc, "1h"},
+		{"10 days beyond 1m retention", 10 * 24 * time.Hour, time.Minute, hc, "5m"},
+		{"60 days only 1h", 60 * 24 * time.Hour, time.Minute, hc, "1h"},
+		{"beyond all retentions uses longest", 1000 * 24 * time.Hour, time.Minute, hc, "1h"},
+		{"retention 0 keeps raw forever", 1000 * 24 * time.Hour, time.Second, forever, "raw"},
+		{"beyond all short retentions", 10 * time.Hour, time.Second, short, "1h"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pickResolution(now.Add(-tt.start), now, tt.step, tt.hc); got.Name != tt.want {
+				t.Errorf("pickResolution = %s, want %s", got.Name, tt.want)
+			}
+		})
+	}
+}
+
+func openTestHistory(t *testing.T, hc HistoryConfig) {
+	t.Helper()
+	hc.Path = filepath.Join(t.TempDir(), "history.db")
+	s, err := openHistory(hc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := history
+	history = s
+	t.Cleanup(func() {
+		history = prev
+		s.db.Close()
+	})
+}
+
+func TestQueryHistory(t *testing.T) {
+	history = nil
+	if _, err := QueryHistory(HistoryQuery{Metric: "cpu_usage"}); err != ErrHistoryDisabled {
+		t.Fatalf("err = %v, want ErrHistoryDisabled", err)
+	}
+
+	openTestHistory(t, defaultHistoryConfig())
+	now := time.Now().Truncate(time.Hour)
+	if time.Since(now) < 5*time.Minute {
+		now = now.Add(-time.Hour) // 保证下面 3 分钟的数据都在当前时间之前
+	}
+	// 每 10s 一个样本，共 3 分钟；磁盘按挂载点分为两个序列
+	for i := 0; i < 18; i++ {
+		ts := now.Add(time.Duration(i) * 10 * time.Second)
+		samples := []historySample{
+			{Metric: "cpu_usage", Value: float64(i)},
+			{Metric: "disk_used_percent", Labels: map[string]string{"path": "/"}, Value: 50},
+			{Metric: "disk_used_percent", Labels: map[string]string{"path": "/data"}, Value: 80},
+		}
+		if err := history.Append(ts, samples); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		q          HistoryQuery
+		resolution string
+		series     int
+		points     []HistoryPoint
+	}{
+		{
+			name:       "1m buckets",
+			q:          HistoryQuery{Metric: "cpu_usage", Start: now, End: now.Add(3 * time.Minute), Step: time.Minute},
+			resolution: "1m",
+			series:     1,
+			points: []HistoryPoint{
+				{T: now.Unix(), Min: 0, Max: 5, Avg: 2.5},
+				{T: now.Add(time.Minute).Unix(), Min: 6, Max: 11, Avg: 8.5},
+				{T: now.Add(2 * time.Minute).Unix(), Min: 12, Max: 17, Avg: 14.5},
+			},
+		},
+		{
+			name:       "raw downsampled to 30s",
+			q:          HistoryQuery{Metric: "cpu_usage", Start: now, End: now.Add(59 * time.Second), Step: 30 * time.Second},
+			resolution: "raw",
+			series:     1,
+			points: []HistoryPoint{
+				{T: now.Unix(), Min: 0, Max: 2, Avg: 1},
+				{T: now.Add(30 * time.Second).Unix(), Min: 3, Max: 5, Avg: 4},
+			},
+		},
+		{
+			name:       "label filter",
+			q:          HistoryQuery{Metric: "disk_used_percent", Labels: map[string]string{"path": "/data"}, Start: now, End: now.Add(3 * time.Minute), Step: 5 * time.Minute},
+			resolution: "5m",
+			series:     1,
+			points:     []HistoryPoint{{T: now.Unix(), Min: 80, Max: 80, Avg: 80}},
+		},
+		{
+			name:       "unknown metric",
+			q:          HistoryQuery{Metric: "nope", Start: now, End: now.Add(time.Minute), Step: time.Minute},
+			resolution: "1m",
+			series:     0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := QueryHistory(tt.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Resolution != tt.resolution {
+				t.Errorf("resolution = %s, want %s", res.Resolution, tt.resolution)
+			}
+			if len(res.Series) != tt.series {
+				t.Fatalf("series = %d, want %d", len(res.Series), tt.series)
+			}
+			if tt.points == nil {
+				return
+			}
+			got := res.Series[0].Points
+			if len(got) != len(tt.points) {
+				t.Fatalf("points = %+v, want %+v", got, tt.points)
+			}
+			for i := range got {
+				if got[i] != tt.points[i] {
+					t.Errorf("point %d = %+v, want %+v", i, got[i], tt.points[i])
+				}
+			}
+		})
+	}
+}
+
+func TestHistoryDeviceMetrics(t *testing.T) {
+	d := &DashboardData{
+		Perf:    PerfInfo{NetRxKBps: 30, DiskReadKBps: 7},
+		Disk:    []DiskInfo{{Path: "/", ReadSpeed: 7}},
+		Network: []NetworkInfo{{Interface: "eth0", RX: 10}, {Interface: "eth1", RX: 20}},
+	}
+	// 汇总值与按设备的序列使用不同的指标名，同名指标总是带设备标签
+	for _, smp := range historySamples(d) {
+		if label, ok := deviceLabels[smp.Metric]; ok && smp.Labels[label] == "" {
+			t.Errorf("%s sample without %s label", smp.Metric, label)
+		}
+	}
+
+	openTestHistory(t, defaultHistoryConfig())
+	ts := time.Now().Add(-time.Minute).Truncate(time.Minute)
+	if err := history.Append(ts, historySamples(d)); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		metric  string
+		labels  map[string]string
+		want    float64
+		wantErr bool
+	}{
+		{"net_rx_kbps_total", nil, 30, false},
+		{"disk_read_kbps_total", nil, 7, false},
+		{"net_rx_kbps", map[string]string{"interface": "eth1"}, 20, false},
+		{"net_rx_kbps", nil, 0, true},
+		{"disk_read_kbps", map[string]string{"interface": "eth0"}, 0, true},
+		{"cpu_core_usage", nil, 0, true},
+	}
+	for _, tt := range tests {
+		res, err := QueryHistory(HistoryQuery{Metric: tt.metric, Labels: tt.labels, Start: ts, End: ts.Add(time.Minute), Step: time.Minute})
+		if tt.wantErr {
+			var le *HistoryLabelError
+			if !errors.As(err, &le) {
+				t.Errorf("%s %v: err = %v, want HistoryLabelError", tt.metric, tt.labels, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Series) != 1 || len(res.Series[0].Points) != 1 || res.Series[0].Points[0].Avg != tt.want {
+			t.Errorf("%s %v = %+v, want one point %v", tt.metric, tt.labels, res.Series, tt.want)
+		}
+	}
+}
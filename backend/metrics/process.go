@@ -0,0 +1,308 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// 进程资源表：逐个读取每个进程的开销较大，不随每秒的采集进行，而是在请求进程数据时按需采集；
+// CPU 与 I/O 速率由相邻两次采集的累计值差分得到。
+
+type ProcessInfo struct {
+	PID         int32   `json:"pid"`
+	PPID        int32   `json:"ppid"`
+	Name        string  `json:"name"`
+	User        string  `json:"user"`
+	Cmdline     string  `json:"cmdline"`
+	CPUPercent  float64 `json:"cpu_percent"` // 相对单核，多线程进程可超过 100
+	RSS         uint64  `json:"rss"`         // 常驻内存（字节）
+	Threads     int32   `json:"threads"`
+	FDs         int32   `json:"fds"`           // 打开的文件描述符 / 句柄数，无权限时为 -1
+	IOReadKBps  float64 `json:"io_read_kbps"`  // 磁盘读速 KB/s，无权限时为 0
+	IOWriteKBps float64 `json:"io_write_kbps"` // 磁盘写速 KB/s
+	StartTime   int64   `json:"start_time"`    // 启动时间（Unix 秒）
+}
+
+// procState 缓存进程的静态信息以及上一周期的累计值
+type procState struct {
+	proc       *process.Process
+	createTime int64 // 毫秒，用于识别 PID 复用
+	name       string
+	user       string
+	cmdline    string
+	cpuTotal   float64 // 累计 CPU 秒数
+	readBytes  uint64
+	writeBytes uint64
+	hasIO      bool
+}
+
+const (
+	procRefresh      = time.Second            // 两次采集的最短间隔，期间的请求直接使用上次结果
+	procBaseline     = 30 * time.Second       // 上次采集早于该时长时先取基准样本，避免速率按过长的间隔平均
+	procBaselineWait = 500 * time.Millisecond // 基准样本与正式采集之间的间隔
+)
+
+var (
+	procMu      sync.Mutex                   // 串行化进程表采集
+	procStates  = make(map[int32]*procState) // 受 procMu 保护
+	procSampled time.Time                    // 上次采集开始的时间，受 procMu 保护
+	procTable   []ProcessInfo                // 受 Mu 保护
+)
+
+// refreshProcesses 按需采集进程表，距上次采集不足 procRefresh 时不重复采集
+func refreshProcesses() {
+	procMu.Lock()
+	defer procMu.Unlock()
+	since := time.Since(procSampled)
+	if since < procRefresh {
+		return
+	}
+	if procSampled.IsZero() || since > procBaseline {
+		procStates = make(map[int32]*procState)
+		procSampled = time.Now()
+		collectProcesses(1)
+		time.Sleep(procBaselineWait)
+	}
+	start := time.Now()
+	list := collectProcesses(start.Sub(procSampled).Seconds())
+	procSampled = start
+
+	Mu.Lock()
+	procTable = list
+	Mu.Unlock()
+}
+
+// processSnapshot 返回最近一次采集的进程表副本
+func processSnapshot() []ProcessInfo {
+	Mu.RLock()
+	defer Mu.RUnlock()
+	return append([]ProcessInfo(nil), procTable...)
+}
+
+func collectProcesses(delta float64) []ProcessInfo {
+	procs, err := process.Processes()
+	if err != nil {
+		fmt.Println("Error process.Processes:", err)
+		return nil
+	}
+
+	out := make([]ProcessInfo, 0, len(procs))
+	alive := make(map[int32]bool, len(procs))
+	for _, p := range procs {
+		ct, err := p.CreateTime()
+		if err != nil {
+			continue // 进程已退出
+		}
+		st, ok := procStates[p.Pid]
+		if !ok || st.createTime != ct {
+			st = &procState{proc: p, createTime: ct}
+			st.name, _ = p.Name()
+			st.user, _ = p.Username()
+			st.cmdline, _ = p.Cmdline()
+			if st.cmdline == "" {
+				st.cmdline = st.name
+			}
+			ok = false
+		}
+		alive[p.Pid] = true
+
+		info := ProcessInfo{
+			PID:       p.Pid,
+			Name:      st.name,
+			User:      st.user,
+			Cmdline:   st.cmdline,
+			StartTime: ct / 1000,
+			FDs:       -1,
+		}
+		info.PPID, _ = st.proc.Ppid()
+		if mi, err := st.proc.MemoryInfo(); err == nil && mi != nil {
+			info.RSS = mi.RSS
+		}
+		info.Threads, _ = st.proc.NumThreads()
+		if n, err := st.proc.NumFDs(); err == nil {
+			info.FDs = n
+		}
+
+		if t, err := st.proc.Times(); err == nil && t != nil {
+			total := t.User + t.System
+			if ok {
+				info.CPUPercent = (total - st.cpuTotal) / delta * 100
+				if info.CPUPercent < 0 {
+					info.CPUPercent = 0
+				}
+			}
+			st.cpuTotal = total
+		}
+		if io, err := st.proc.IOCounters(); err == nil && io != nil {
+			if ok && st.hasIO && io.ReadBytes >= st.readBytes && io.WriteBytes >= st.writeBytes {
+				info.IOReadKBps = float64(io.ReadBytes-st.readBytes) / 1024 / delta
+				info.IOWriteKBps = float64(io.WriteBytes-st.writeBytes) / 1024 / delta
+			}
+			st.readBytes, st.writeBytes, st.hasIO = io.ReadBytes, io.WriteBytes, true
+		}
+
+		procStates[p.Pid] = st
+		out = append(out, info)
+	}
+	for pid := range procStates {
+		if !alive[pid] {
+			delete(procStates, pid)
+		}
+	}
+	return out
+}
+
+// processLess 按 json 字段名比较两个进程，未知字段返回 nil
+func processLess(field string) func(a, b *ProcessInfo) bool {
+	switch field {
+	case "pid":
+		return func(a, b *ProcessInfo) bool { return a.PID < b.PID }
+	case "ppid":
+		return func(a, b *ProcessInfo) bool { return a.PPID < b.PPID }
+	case "name":
+		return func(a, b *ProcessInfo) bool { return strings.ToLower(a.Name) < strings.ToLower(b.Name) }
+	case "user":
+		return func(a, b *ProcessInfo) bool { return a.User < b.User }
+	case "cmdline":
+		return func(a, b *ProcessInfo) bool { return a.Cmdline < b.Cmdline }
+	case "cpu_percent":
+		return func(a, b *ProcessInfo) bool { return a.CPUPercent < b.CPUPercent }
+	case "rss":
+		return func(a, b *ProcessInfo) bool { return a.RSS < b.RSS }
+	case "threads":
+		return func(a, b *ProcessInfo) bool { return a.Threads < b.Threads }
+	case "fds":
+		return func(a, b *ProcessInfo) bool { return a.FDs < b.FDs }
+	case "io_read_kbps":
+		return func(a, b *ProcessInfo) bool { return a.IOReadKBps < b.IOReadKBps }
+	case "io_write_kbps":
+		return func(a, b *ProcessInfo) bool { return a.IOWriteKBps < b.IOWriteKBps }
+	case "start_time":
+		return func(a, b *ProcessInfo) bool { return a.StartTime < b.StartTime }
+	}
+	return nil
+}
+
+// GetProcesses 返回按 sortBy 排序后的前 limit 个进程以及进程总数
+func GetProcesses(sortBy, order string, limit int) ([]ProcessInfo, int, error) {
+	if sortBy == "" {
+		sortBy = "cpu_percent"
+	}
+	less := processLess(sortBy)
+	if less == nil {
+		return nil, 0, fmt.Errorf("unknown sort column %q", sortBy)
+	}
+	desc := order != "asc"
+
+	refreshProcesses()
+	items := processSnapshot()
+
+	sort.SliceStable(items, func(i, j int) bool {
+		if desc {
+			return less(&items[j], &items[i])
+		}
+		return less(&items[i], &items[j])
+	})
+	total := len(items)
+	if limit <= 0 {
+		limit = 20
+	}
+	if limit < total {
+		items = items[:limit]
+	}
+	return items, total, nil
+}
+
+// ProcessNode 是进程树中的一个节点
+type ProcessNode struct {
+	ProcessInfo
+	Children []*ProcessNode `json:"children,omitempty"`
+}
+
+func indexProcesses(list []ProcessInfo) map[int32]*ProcessInfo {
+	idx := make(map[int32]*ProcessInfo, len(list))
+	for i := range list {
+		idx[list[i].PID] = &list[i]
+	}
+	return idx
+}
+
+// GetProcessTree 按 PPID 组装完整的进程树，父进程不在表中的进程作为根节点
+func GetProcessTree() []*ProcessNode {
+	refreshProcesses()
+	list := processSnapshot()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].PID < list[j].PID })
+	nodes := make(map[int32]*ProcessNode, len(list))
+	for _, p := range list {
+		nodes[p.PID] = &ProcessNode{ProcessInfo: p}
+	}
+	roots := []*ProcessNode{}
+	for _, p := range list {
+		n := nodes[p.PID]
+		if parent, ok := nodes[p.PPID]; ok && p.PPID != p.PID {
+			parent.Children = append(parent.Children, n)
+		} else {
+			roots = append(roots, n)
+		}
+	}
+	return roots
+}
+
+var ErrProcessNotFound = errors.New("process not found")
+
+// GetAncestry 返回从 pid 本身到最顶层祖先的进程链
+func GetAncestry(pid int32) ([]ProcessInfo, error) {
+	refreshProcesses()
+	idx := indexProcesses(processSnapshot())
+
+	chain := ancestryFrom(idx, pid)
+	if len(chain) == 0 {
+		return nil, ErrProcessNotFound
+	}
+	return chain, nil
+}
+
+// ancestryFrom 沿 PPID 向上查找；进程表里没有的（两次采集之间新启动的）进程直接实时读取
+func ancestryFrom(idx map[int32]*ProcessInfo, pid int32) []ProcessInfo {
+	var chain []ProcessInfo
+	seen := make(map[int32]bool)
+	for pid > 0 && !seen[pid] && len(chain) < 64 {
+		seen[pid] = true
+		if p, ok := idx[pid]; ok {
+			chain = append(chain, *p)
+			pid = p.PPID
+			continue
+		}
+		p, err := process.NewProcess(pid)
+		if err != nil {
+			break
+		}
+		info := ProcessInfo{PID: pid, FDs: -1}
+		info.Name, _ = p.Name()
+		info.PPID, _ = p.Ppid()
+		info.User, _ = p.Username()
+		info.Cmdline, _ = p.Cmdline()
+		if ct, err := p.CreateTime(); err == nil {
+			info.StartTime = ct / 1000
+		}
+		chain = append(chain, info)
+		pid = info.PPID
+	}
+	return chain
+}
+
+// ancestryNames 把进程链格式化为 ["python3(4321)", "bash(4300)", "sshd(812)", ...]
+func ancestryNames(chain []ProcessInfo) []string {
+	out := make([]string, 0, len(chain))
+	for _, p := range chain {
+		out = append(out, fmt.Sprintf("%s(%d)", p.Name, p.PID))
+	}
+	return out
+}
@@ -0,0 +1,185 @@
+package metrics
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setProcTable 用给定的进程表代替实时采集，procRefresh 内不会重新采集
+func setProcTable(t *testing.T, list []ProcessInfo) {
+	t.Helper()
+	procMu.Lock()
+	prevSampled := procSampled
+	procSampled = time.Now().Add(time.Hour)
+	procMu.Unlock()
+	Mu.Lock()
+	prevTable := procTable
+	procTable = list
+	Mu.Unlock()
+	t.Cleanup(func() {
+		procMu.Lock()
+		procSampled = prevSampled
+		procMu.Unlock()
+		Mu.Lock()
+		procTable = prevTable
+		Mu.Unlock()
+	})
+}
+
+func TestGetProcesses(t *testing.T) {
+	setProcTable(t, []ProcessInfo{
+		{PID: 1, Name: "systemd", CPUPercent: 0.1, RSS: 12 << 20, IOReadKBps: 5},
+		{PID: 812, Name: "sshd", CPUPercent: 2, RSS: 8 << 20},
+		{PID: 4321, Name: "Python3", CPUPercent: 150, RSS: 300 << 20, IOWriteKBps: 40},
+		{PID: 4300, Name: "bash", CPUPercent: 0, RSS: 4 << 20},
+	})
+	pids := func(list []ProcessInfo) []int32 {
+		out := make([]int32, len(list))
+		for i, p := range list {
+			out[i] = p.PID
+		}
+		return out
+	}
+	tests := []struct {
+		sortBy, order string
+		limit         int
+		want          []int32
+		wantErr       bool
+	}{
+		{"", "", 0, []int32{4321, 812, 1, 4300}, false}, // 默认按 CPU 降序
+		{"rss", "desc", 2, []int32{4321, 1}, false},
+		{"pid", "asc", 3, []int32{1, 812, 4300}, false},
+		{"name", "asc", 0, []int32{4300, 4321, 812, 1}, false}, // 名称比较不区分大小写
+		{"io_write_kbps", "desc", 1, []int32{4321}, false},
+		{"io_read_kbps", "desc", 1, []int32{1}, false},
+		{"memory", "", 0, nil, true},
+	}
+	for _, tt := range tests {
+		list, total, err := GetProcesses(tt.sortBy, tt.order, tt.limit)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("GetProcesses(%q) accepted unknown column", tt.sortBy)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != 4 || len(list) != len(tt.want) {
+			t.Fatalf("GetProcesses(%q, %q, %d) = %v, total %d", tt.sortBy, tt.order, tt.limit, pids(list), total)
+		}
+		for i := range list {
+			if list[i].PID != tt.want[i] {
+				t.Errorf("GetProcesses(%q, %q, %d) = %v, want %v", tt.sortBy, tt.order, tt.limit, pids(list), tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestProcessLessColumns(t *testing.T) {
+	for _, f := range []string{"pid", "ppid", "name", "user", "cmdline", "cpu_percent", "rss", "threads", "fds", "io_read_kbps", "io_write_kbps", "start_time"} {
+		if processLess(f) == nil {
+			t.Errorf("column %s not sortable", f)
+		}
+	}
+}
+
+func TestCollectProcessesLive(t *testing.T) {
+	procMu.Lock()
+	defer procMu.Unlock()
+	prev := procStates
+	procStates = make(map[int32]*procState)
+	defer func() { procStates = prev }()
+
+	collectProcesses(1)
+	list := collectProcesses(0.1)
+	for _, p := range list {
+		if p.PID != int32(os.Getpid()) {
+			continue
+		}
+		if p.Name == "" || p.Threads <= 0 || p.RSS == 0 || p.StartTime == 0 {
+			t.Errorf("own process = %+v", p)
+		}
+		if p.CPUPercent < 0 || p.IOReadKBps < 0 {
+			t.Errorf("negative rate: %+v", p)
+		}
+		return
+	}
+	t.Errorf("own pid %d not in %d processes", os.Getpid(), len(list))
+}
+
+func TestGetProcessTree(t *testing.T) {
+	setProcTable(t, []ProcessInfo{
+		{PID: 4321, PPID: 4300, Name: "python3"},
+		{PID: 1, PPID: 0, Name: "systemd"},
+		{PID: 4300, PPID: 812, Name: "bash"},
+		{PID: 812, PPID: 1, Name: "sshd"},
+		{PID: 900, PPID: 777, Name: "orphan"}, // 父进程已退出
+		{PID: 2, PPID: 2, Name: "self"},       // 自身为父进程不应形成环
+		{PID: 813, PPID: 1, Name: "cron"},
+	})
+	var render func(nodes []*ProcessNode) string
+	render = func(nodes []*ProcessNode) string {
+		parts := make([]string, len(nodes))
+		for i, n := range nodes {
+			parts[i] = n.Name
+			if len(n.Children) > 0 {
+				parts[i] += "(" + render(n.Children) + ")"
+			}
+		}
+		return strings.Join(parts, " ")
+	}
+	want := "systemd(sshd(bash(python3)) cron) self orphan"
+	if got := render(GetProcessTree()); got != want {
+		t.Errorf("tree = %s, want %s", got, want)
+	}
+}
+
+func TestAncestryFrom(t *testing.T) {
+	idx := indexProcesses([]ProcessInfo{
+		{PID: 4321, PPID: 4300, Name: "python3"},
+		{PID: 4300, PPID: 812, Name: "bash"},
+		{PID: 812, PPID: 0, Name: "sshd"},
+		{PID: 70, PPID: 71, Name: "a"}, // 异常的 PPID 环
+		{PID: 71, PPID: 70, Name: "b"},
+	})
+	tests := []struct {
+		pid  int32
+		want string
+	}{
+		{4321, "python3(4321) bash(4300) sshd(812)"},
+		{812, "sshd(812)"},
+		{70, "a(70) b(71)"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(ancestryNames(ancestryFrom(idx, tt.pid)), " "); got != tt.want {
+			t.Errorf("ancestry(%d) = %s, want %s", tt.pid, got, tt.want)
+		}
+	}
+
+	// 链长超过上限时截断
+	long := make([]ProcessInfo, 100)
+	for i := range long {
+		long[i] = ProcessInfo{PID: int32(1000 + i), PPID: int32(1001 + i)}
+	}
+	if n := len(ancestryFrom(indexProcesses(long), 1000)); n != 64 {
+		t.Errorf("chain length = %d, want 64", n)
+	}
+}
+
+func TestAncestryLiveFallback(t *testing.T) {
+	// 进程表里没有的进程实时读取，一直找到 init
+	chain := ancestryFrom(map[int32]*ProcessInfo{}, int32(os.Getpid()))
+	if len(chain) == 0 || chain[0].PID != int32(os.Getpid()) || chain[0].Name == "" || chain[0].FDs != -1 {
+		t.Fatalf("chain = %+v", chain)
+	}
+	if last := chain[len(chain)-1]; last.PPID != 0 {
+		t.Errorf("chain ends at %d with ppid %d", last.PID, last.PPID)
+	}
+	if len(ancestryFrom(nil, 1<<30)) != 0 {
+		t.Error("nonexistent pid returned a chain")
+	}
+}
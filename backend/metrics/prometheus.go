@@ -0,0 +1,260 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Prometheus 文本格式（0.0.4）与 OpenMetrics 1.0 导出。
+// 速率类数据直接取自 Latest，原始字节计数器取自最近一次采集的 IOCounters。
+
+const (
+	PromContentType        = "text/plain; version=0.0.4; charset=utf-8"
+	OpenMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+type promSample struct {
+	labels []string // 成对出现的 key, value
+	value  float64
+}
+
+type promWriter struct {
+	buf         bytes.Buffer
+	openMetrics bool
+}
+
+// family 输出一个指标族；counter 的名称不带 _total 后缀，由本函数按格式补齐
+func (w *promWriter) family(name, typ, help string, samples ...promSample) {
+	if len(samples) == 0 {
+		return
+	}
+	full := "sysmon_" + name
+	sampleName := full
+	if typ == "counter" {
+		sampleName = full + "_total"
+		if !w.openMetrics {
+			full = sampleName
+		}
+	}
+	fmt.Fprintf(&w.buf, "# HELP %s %s\n", full, help)
+	fmt.Fprintf(&w.buf, "# TYPE %s %s\n", full, typ)
+	for _, s := range samples {
+		w.buf.WriteString(sampleName)
+		if len(s.labels) > 0 {
+			w.buf.WriteByte('{')
+			for i := 0; i+1 < len(s.labels); i += 2 {
+				if i > 0 {
+					w.buf.WriteByte(',')
+				}
+				w.buf.WriteString(s.labels[i])
+				w.buf.WriteString(`="`)
+				w.buf.WriteString(escapeLabel(s.labels[i+1]))
+				w.buf.WriteByte('"')
+			}
+			w.buf.WriteByte('}')
+		}
+		w.buf.WriteByte(' ')
+		w.buf.WriteString(formatPromValue(s.value))
+		w.buf.WriteByte('\n')
+	}
+}
+
+func (w *promWriter) gauge(name, help string, v float64) {
+	w.family(name, "gauge", help, promSample{value: v})
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+func formatPromValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// WritePrometheus 生成 /metrics 的响应体
+func WritePrometheus(openMetrics bool) []byte {
+	Mu.RLock()
+	d := Latest
+	diskIO := rawDiskIO
+	netIO := rawNetIO
+	fired := make(map[string]uint64, len(alertsFired))
+	for k, v := range alertsFired {
+		fired[k] = v
+	}
+	Mu.RUnlock()
+
+	w := &promWriter{openMetrics: openMetrics}
+
+	w.family("info", "gauge", "Host information, value is always 1.", promSample{
+		labels: []string{"hostname", d.System.Hostname, "os", d.System.OS, "platform", d.System.Platform, "cpu_model", d.CPU.ModelName},
+		value:  1,
+	})
+	w.gauge("last_collect_timestamp_seconds", "Unix time of the last collection cycle.", float64(d.Timestamp))
+	w.gauge("boot_time_seconds", "Unix time the host booted.", float64(d.System.BootTime))
+	w.gauge("processes", "Number of processes.", float64(d.System.Procs))
+
+	// CPU
+	w.gauge("cpu_usage_percent", "Total CPU usage in percent.", d.CPU.Usage)
+	var cores []promSample
+	for i, v := range d.CPU.PerCore {
+		cores = append(cores, promSample{labels: []string{"core", strconv.Itoa(i)}, value: v})
+	}
+	w.family("cpu_core_usage_percent", "gauge", "Per-core CPU usage in percent.", cores...)
+	w.gauge("cpu_cores", "Number of logical CPU cores.", float64(d.CPU.Cores))
+	w.gauge("cpu_frequency_mhz", "CPU frequency in MHz.", d.CPU.Mhz)
+	w.gauge("load1", "1-minute load average.", d.Perf.Load1)
+	w.gauge("load5", "5-minute load average.", d.Perf.Load5)
+	w.gauge("load15", "15-minute load average.", d.Perf.Load15)
+	w.gauge("cpu_temperature_celsius", "CPU temperature, 0 when unsupported.", d.Perf.CPUTemp)
+
+	// Memory
+	w.gauge("memory_total_bytes", "Total physical memory.", float64(d.Memory.Total))
+	w.gauge("memory_used_bytes", "Used physical memory.", float64(d.Memory.Used))
+	w.gauge("memory_free_bytes", "Free physical memory.", float64(d.Memory.Free))
+	w.gauge("memory_used_percent", "Used physical memory in percent.", d.Memory.UsedPercent)
+	w.gauge("swap_total_bytes", "Total swap.", float64(d.Memory.SwapTotal))
+	w.gauge("swap_used_bytes", "Used swap.", float64(d.Memory.SwapUsed))
+
+	// Disk
+	var dTotal, dUsed, dPct, dRead, dWrite []promSample
+	for _, dk := range d.Disk {
+		l := []string{"path", dk.Path}
+		dTotal = append(dTotal, promSample{labels: l, value: float64(dk.Total)})
+		dUsed = append(dUsed, promSample{labels: l, value: float64(dk.Used)})
+		dPct = append(dPct, promSample{labels: l, value: dk.UsedPercent})
+		dRead = append(dRead, promSample{labels: l, value: dk.ReadSpeed})
+		dWrite = append(dWrite, promSample{labels: l, value: dk.WriteSpeed})
+	}
+	w.family("disk_total_bytes", "gauge", "Filesystem size.", dTotal...)
+	w.family("disk_used_bytes", "gauge", "Filesystem used space.", dUsed...)
+	w.family("disk_used_percent", "gauge", "Filesystem used space in percent.", dPct...)
+	w.family("disk_read_kbps", "gauge", "Disk read rate in KB/s.", dRead...)
+	w.family("disk_write_kbps", "gauge", "Disk write rate in KB/s.", dWrite...)
+
+	devices := make([]string, 0, len(diskIO))
+	for name := range diskIO {
+		devices = append(devices, name)
+	}
+	sort.Strings(devices)
+	var rBytes, wBytes, rOps, wOps []promSample
+	for _, name := range devices {
+		io := diskIO[name]
+		l := []string{"device", name}
+		rBytes = append(rBytes, promSample{labels: l, value: float64(io.ReadBytes)})
+		wBytes = append(wBytes, promSample{labels: l, value: float64(io.WriteBytes)})
+		rOps = append(rOps, promSample{labels: l, value: float64(io.ReadCount)})
+		wOps = append(wOps, promSample{labels: l, value: float64(io.WriteCount)})
+	}
+	w.family("disk_read_bytes", "counter", "Bytes read from the device.", rBytes...)
+	w.family("disk_written_bytes", "counter", "Bytes written to the device.", wBytes...)
+	w.family("disk_reads_completed", "counter", "Read operations completed.", rOps...)
+	w.family("disk_writes_completed", "counter", "Write operations completed.", wOps...)
+
+	// Network
+	var nRx, nTx []promSample
+	for _, n := range d.Network {
+		l := []string{"interface", n.Interface}
+		nRx = append(nRx, promSample{labels: l, value: n.RX})
+		nTx = append(nTx, promSample{labels: l, value: n.TX})
+	}
+	w.family("network_receive_kbps", "gauge", "Network receive rate in KB/s.", nRx...)
+	w.family("network_transmit_kbps", "gauge", "Network transmit rate in KB/s.", nTx...)
+
+	ifaces := make([]string, 0, len(netIO))
+	for name := range netIO {
+		ifaces = append(ifaces, name)
+	}
+	sort.Strings(ifaces)
+	var rxBytes, txBytes, rxPkts, txPkts []promSample
+	for _, name := range ifaces {
+		io := netIO[name]
+		l := []string{"interface", name}
+		rxBytes = append(rxBytes, promSample{labels: l, value: float64(io.BytesRecv)})
+		txBytes = append(txBytes, promSample{labels: l, value: float64(io.BytesSent)})
+		rxPkts = append(rxPkts, promSample{labels: l, value: float64(io.PacketsRecv)})
+		txPkts = append(txPkts, promSample{labels: l, value: float64(io.PacketsSent)})
+	}
+	w.family("network_receive_bytes", "counter", "Bytes received on the interface.", rxBytes...)
+	w.family("network_transmit_bytes", "counter", "Bytes sent on the interface.", txBytes...)
+	w.family("network_receive_packets", "counter", "Packets received on the interface.", rxPkts...)
+	w.family("network_transmit_packets", "counter", "Packets sent on the interface.", txPkts...)
+
+	// Alerts
+	current := map[string]float64{"warn": 0, "critical": 0}
+	for _, a := range d.Current {
+		current[a.Level]++
+	}
+	w.family("alerts_current", "gauge", "Alerts currently firing or acknowledged.", levelSamples(current)...)
+	total := map[string]float64{"warn": 0, "critical": 0}
+	for k, v := range fired {
+		total[k] = float64(v)
+	}
+	w.family("alerts", "counter", "Alert incidents raised since start.", levelSamples(total)...)
+	w.gauge("alert_log_entries", "Entries kept in the alert log.", float64(len(d.Alerts)))
+
+	// 其他模块注册的指标
+	extraMu.RLock()
+	for _, m := range extraMetrics {
+		w.family(m.name, m.typ, m.help, promSample{value: m.value()})
+	}
+	extraMu.RUnlock()
+
+	if openMetrics {
+		w.buf.WriteString("# EOF\n")
+	}
+	return w.buf.Bytes()
+}
+
+type extraMetric struct {
+	name, typ, help string
+	value           func() float64
+}
+
+var (
+	extraMu      sync.RWMutex
+	extraMetrics []extraMetric
+)
+
+// RegisterGauge 注册一个由其他模块提供的 gauge，name 不含 sysmon_ 前缀
+func RegisterGauge(name, help string, value func() float64) {
+	registerMetric(extraMetric{name: name, typ: "gauge", help: help, value: value})
+}
+
+// RegisterCounter 注册一个由其他模块提供的 counter，name 不含 sysmon_ 前缀与 _total 后缀
+func RegisterCounter(name, help string, value func() float64) {
+	registerMetric(extraMetric{name: name, typ: "counter", help: help, value: value})
+}
+
+func registerMetric(m extraMetric) {
+	extraMu.Lock()
+	extraMetrics = append(extraMetrics, m)
+	extraMu.Unlock()
+}
+
+func levelSamples(m map[string]float64) []promSample {
+	levels := make([]string, 0, len(m))
+	for k := range m {
+		levels = append(levels, k)
+	}
+	sort.Strings(levels)
+	out := make([]promSample, 0, len(levels))
+	for _, k := range levels {
+		out = append(out, promSample{labels: []string{"level", k}, value: m[k]})
+	}
+	return out
+}
@@ -0,0 +1,237 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 声明式告警规则：每条规则引用 PerfInfo / DiskInfo / NetworkInfo 的某个字段（按 json 名），
+// 条件持续满足 For 时长后触发。磁盘与网卡规则按实例（挂载点 / 网卡名）分别评估。
+
+type AlertRule struct {
+	Name      string            `yaml:"name"`
+	Field     string            `yaml:"field"`     // 如 perf.cpu_usage、disk.used_percent、network.rx
+	Op        string            `yaml:"op"`        // > >= < <= == !=
+	Threshold float64           `yaml:"threshold"` // 阈值
+	For       time.Duration     `yaml:"for"`       // 条件需持续多久才触发，0 表示立即触发
+	Severity  string            `yaml:"severity"`  // warn / critical
+	Labels    map[string]string `yaml:"labels,omitempty"`
+	Text      string            `yaml:"text,omitempty"` // 描述模板，支持 {value} {threshold} {instance} {name}
+}
+
+type compiledRule struct {
+	AlertRule
+	scope string // perf / disk / network
+	index []int  // 字段在结构体中的反射索引
+}
+
+type ruleInstance struct {
+	instance string            // 磁盘挂载点或网卡名，perf 规则为空
+	labels   map[string]string // 实例标签，如 path=/data
+	value    reflect.Value
+}
+
+var (
+	rulesMu sync.RWMutex
+	rules   []compiledRule
+	pending = make(map[string]time.Time) // rule|instance -> 条件首次满足的时间，仅采集协程访问
+)
+
+var scopeTypes = map[string]reflect.Type{
+	"perf":    reflect.TypeOf(PerfInfo{}),
+	"disk":    reflect.TypeOf(DiskInfo{}),
+	"network": reflect.TypeOf(NetworkInfo{}),
+}
+
+// defaultAlertRules 对应原先写死在 collect() 中的 CPU / 内存检查
+func defaultAlertRules(c Config) []AlertRule {
+	return []AlertRule{
+		{Name: "cpu_high", Field: "perf.cpu_usage", Op: ">", Threshold: c.CPUWarn, Severity: "warn", Text: "CPU 使用率过高：{value}%"},
+		{Name: "mem_high", Field: "perf.mem_used_percent", Op: ">", Threshold: c.MemWarn, Severity: "warn", Text: "内存使用率过高：{value}%"},
+	}
+}
+
+// compileRules 校验整组规则，任一规则非法时返回错误
+func compileRules(list []AlertRule) ([]compiledRule, error) {
+	compiled := make([]compiledRule, 0, len(list))
+	seen := make(map[string]bool)
+	for i, r := range list {
+		cr, err := compileRule(r)
+		if err != nil {
+			return nil, fmt.Errorf("rule #%d (%s): %w", i+1, r.Name, err)
+		}
+		if seen[cr.Name] {
+			return nil, fmt.Errorf("rule #%d: duplicate name %q", i+1, cr.Name)
+		}
+		seen[cr.Name] = true
+		compiled = append(compiled, cr)
+	}
+	return compiled, nil
+}
+
+func GetAlertRules() []AlertRule {
+	rulesMu.RLock()
+	defer rulesMu.RUnlock()
+	out := make([]AlertRule, len(rules))
+	for i, r := range rules {
+		out[i] = r.AlertRule
+	}
+	return out
+}
+
+func compileRule(r AlertRule) (compiledRule, error) {
+	if r.Name == "" {
+		return compiledRule{}, errors.New("name is required")
+	}
+	switch r.Op {
+	case ">", ">=", "<", "<=", "==", "!=":
+	default:
+		return compiledRule{}, fmt.Errorf("unsupported op %q", r.Op)
+	}
+	if r.Severity == "" {
+		r.Severity = "warn"
+	}
+	if r.Severity != "warn" && r.Severity != "critical" {
+		return compiledRule{}, fmt.Errorf("severity must be warn or critical, got %q", r.Severity)
+	}
+	if r.For < 0 {
+		return compiledRule{}, errors.New("for must not be negative")
+	}
+	scope, field, ok := strings.Cut(r.Field, ".")
+	t, known := scopeTypes[scope]
+	if !ok || !known {
+		return compiledRule{}, fmt.Errorf("field %q must look like perf.<name>, disk.<name> or network.<name>", r.Field)
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if name, _, _ := strings.Cut(f.Tag.Get("json"), ","); name != field {
+			continue
+		}
+		switch f.Type.Kind() {
+		case reflect.Float32, reflect.Float64, reflect.Int, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+			return compiledRule{AlertRule: r, scope: scope, index: f.Index}, nil
+		}
+		return compiledRule{}, fmt.Errorf("field %q is not numeric", r.Field)
+	}
+	return compiledRule{}, fmt.Errorf("unknown field %q", r.Field)
+}
+
+func numericValue(v reflect.Value) float64 {
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	}
+	return 0
+}
+
+func compare(v float64, op string, threshold float64) bool {
+	switch op {
+	case ">":
+		return v > threshold
+	case ">=":
+		return v >= threshold
+	case "<":
+		return v < threshold
+	case "<=":
+		return v <= threshold
+	case "==":
+		return v == threshold
+	case "!=":
+		return v != threshold
+	}
+	return false
+}
+
+func (r compiledRule) instances(perf PerfInfo, disks []DiskInfo, nets []NetworkInfo) []ruleInstance {
+	switch r.scope {
+	case "perf":
+		return []ruleInstance{{value: reflect.ValueOf(perf).FieldByIndex(r.index)}}
+	case "disk":
+		out := make([]ruleInstance, 0, len(disks))
+		for _, d := range disks {
+			out = append(out, ruleInstance{instance: d.Path, labels: map[string]string{"path": d.Path}, value: reflect.ValueOf(d).FieldByIndex(r.index)})
+		}
+		return out
+	case "network":
+		out := make([]ruleInstance, 0, len(nets))
+		for _, n := range nets {
+			out = append(out, ruleInstance{instance: n.Interface, labels: map[string]string{"interface": n.Interface}, value: reflect.ValueOf(n).FieldByIndex(r.index)})
+		}
+		return out
+	}
+	return nil
+}
+
+func (r compiledRule) describe(inst string, v float64) string {
+	text := r.Text
+	if text == "" {
+		text = fmt.Sprintf("%s %s %s（当前 {value}）", r.Field, r.Op, strconv.FormatFloat(r.Threshold, 'f', -1, 64))
+		if inst != "" {
+			text = "[{instance}] " + text
+		}
+	}
+	return strings.NewReplacer(
+		"{value}", strconv.FormatFloat(v, 'f', 1, 64),
+		"{threshold}", strconv.FormatFloat(r.Threshold, 'f', -1, 64),
+		"{instance}", inst,
+		"{name}", r.Name,
+	).Replace(text)
+}
+
+// evaluateRules 在每个采集周期调用，返回本周期处于触发状态的告警
+func evaluateRules(now time.Time, perf PerfInfo, disks []DiskInfo, nets []NetworkInfo) []AlertInfo {
+	rulesMu.RLock()
+	defer rulesMu.RUnlock()
+
+	var out []AlertInfo
+	active := make(map[string]bool)
+	for _, r := range rules {
+		for _, inst := range r.instances(perf, disks, nets) {
+			v := numericValue(inst.value)
+			key := r.Name + "|" + inst.instance
+			if !compare(v, r.Op, r.Threshold) {
+				continue
+			}
+			active[key] = true
+			since, ok := pending[key]
+			if !ok {
+				since = now
+				pending[key] = now
+			}
+			if now.Sub(since) < r.For {
+				continue
+			}
+			labels := make(map[string]string, len(r.Labels)+len(inst.labels))
+			for k, v := range r.Labels {
+				labels[k] = v
+			}
+			for k, v := range inst.labels {
+				labels[k] = v
+			}
+			out = append(out, AlertInfo{
+				Level:  r.Severity,
+				Text:   r.describe(inst.instance, v),
+				Time:   now.Format("15:04:05"),
+				Rule:   r.Name,
+				Labels: labels,
+				Value:  v,
+			})
+		}
+	}
+	// 条件不再满足（或规则被删除）的实例重新计时
+	for key := range pending {
+		if !active[key] {
+			delete(pending, key)
+		}
+	}
+	return out
+}
@@ -0,0 +1,169 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompileRule(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    AlertRule
+		wantErr string
+	}{
+		{"perf field", AlertRule{Name: "cpu", Field: "perf.cpu_usage", Op: ">", Threshold: 90}, ""},
+		{"disk field", AlertRule{Name: "disk", Field: "disk.used_percent", Op: ">=", Threshold: 90, Severity: "critical"}, ""},
+		{"network field", AlertRule{Name: "rx", Field: "network.rx", Op: ">", Threshold: 1000}, ""},
+		{"uint field", AlertRule{Name: "swap", Field: "perf.swap_used", Op: "!=", Threshold: 0}, ""},
+		{"missing name", AlertRule{Field: "perf.cpu_usage", Op: ">"}, "name is required"},
+		{"bad op", AlertRule{Name: "x", Field: "perf.cpu_usage", Op: "=>"}, "unsupported op"},
+		{"bad severity", AlertRule{Name: "x", Field: "perf.cpu_usage", Op: ">", Severity: "info"}, "severity"},
+		{"negative for", AlertRule{Name: "x", Field: "perf.cpu_usage", Op: ">", For: -time.Second}, "for must not be negative"},
+		{"unknown scope", AlertRule{Name: "x", Field: "gpu.usage", Op: ">"}, "must look like"},
+		{"no scope", AlertRule{Name: "x", Field: "cpu_usage", Op: ">"}, "must look like"},
+		{"unknown field", AlertRule{Name: "x", Field: "perf.nope", Op: ">"}, "unknown field"},
+		{"non-numeric field", AlertRule{Name: "x", Field: "disk.path", Op: ">"}, "not numeric"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr, err := compileRule(tt.rule)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if cr.Severity == "" {
+					t.Error("severity default not applied")
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := compileRules([]AlertRule{
+		{Name: "dup", Field: "perf.cpu_usage", Op: ">"},
+		{Name: "dup", Field: "perf.load1", Op: ">"},
+	}); err == nil || !strings.Contains(err.Error(), "duplicate") {
+		t.Errorf("duplicate names: err = %v", err)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		v, threshold float64
+		op           string
+		want         bool
+	}{
+		{91, 90, ">", true},
+		{90, 90, ">", false},
+		{90, 90, ">=", true},
+		{89, 90, "<", true},
+		{90, 90, "<=", true},
+		{90, 90, "==", true},
+		{90, 90, "!=", false},
+		{1, 0, "!=", true},
+		{1, 0, "??", false},
+	}
+	for _, tt := range tests {
+		if got := compare(tt.v, tt.op, tt.threshold); got != tt.want {
+			t.Errorf("compare(%v %s %v) = %v, want %v", tt.v, tt.op, tt.threshold, got, tt.want)
+		}
+	}
+}
+
+// setTestRules 替换当前规则，测试结束后恢复
+func setTestRules(t *testing.T, list []AlertRule) {
+	t.Helper()
+	compiled, err := compileRules(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rulesMu.Lock()
+	prev := rules
+	rules = compiled
+	rulesMu.Unlock()
+	for k := range pending {
+		delete(pending, k)
+	}
+	t.Cleanup(func() {
+		rulesMu.Lock()
+		rules = prev
+		rulesMu.Unlock()
+		for k := range pending {
+			delete(pending, k)
+		}
+	})
+}
+
+func TestEvaluateRules(t *testing.T) {
+	setTestRules(t, []AlertRule{
+		{Name: "cpu_high", Field: "perf.cpu_usage", Op: ">", Threshold: 80, Text: "CPU 使用率过高：{value}%"},
+		{Name: "disk_full", Field: "disk.used_percent", Op: ">=", Threshold: 90, Severity: "critical", Labels: map[string]string{"team": "ops"}},
+		{Name: "rx_high", Field: "network.rx", Op: ">", Threshold: 1000, For: 10 * time.Second},
+	})
+	disks := []DiskInfo{{Path: "/", UsedPercent: 50}, {Path: "/data", UsedPercent: 95}}
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		at   time.Duration
+		perf PerfInfo
+		nets []NetworkInfo
+		want []string // 触发的 规则|描述
+	}{
+		{
+			name: "cpu and one disk fire, rx pending",
+			perf: PerfInfo{CPUUsage: 95.25},
+			nets: []NetworkInfo{{Interface: "eth0", RX: 2000}},
+			want: []string{"cpu_high|CPU 使用率过高：95.2%", "disk_full|[/data] disk.used_percent >= 90（当前 95.0）"},
+		},
+		{
+			name: "rx still within for",
+			at:   5 * time.Second,
+			perf: PerfInfo{CPUUsage: 10},
+			nets: []NetworkInfo{{Interface: "eth0", RX: 2000}},
+			want: []string{"disk_full|[/data] disk.used_percent >= 90（当前 95.0）"},
+		},
+		{
+			name: "rx fires after for",
+			at:   10 * time.Second,
+			perf: PerfInfo{CPUUsage: 10},
+			nets: []NetworkInfo{{Interface: "eth0", RX: 2000}},
+			want: []string{"disk_full|[/data] disk.used_percent >= 90（当前 95.0）", "rx_high|[eth0] network.rx > 1000（当前 2000.0）"},
+		},
+		{
+			name: "rx drops and restarts its timer",
+			at:   11 * time.Second,
+			perf: PerfInfo{CPUUsage: 10},
+			nets: []NetworkInfo{{Interface: "eth0", RX: 10}},
+			want: []string{"disk_full|[/data] disk.used_percent >= 90（当前 95.0）"},
+		},
+		{
+			name: "rx above again is pending",
+			at:   20 * time.Second,
+			perf: PerfInfo{CPUUsage: 10},
+			nets: []NetworkInfo{{Interface: "eth0", RX: 2000}},
+			want: []string{"disk_full|[/data] disk.used_percent >= 90（当前 95.0）"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alerts := evaluateRules(t0.Add(tt.at), tt.perf, disks, tt.nets)
+			var got []string
+			for _, a := range alerts {
+				got = append(got, a.Rule+"|"+a.Text)
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("alerts =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+			for _, a := range alerts {
+				if a.Rule == "disk_full" && (a.Level != "critical" || a.Labels["path"] != "/data" || a.Labels["team"] != "ops") {
+					t.Errorf("disk_full alert = %+v", a)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"system-monitor/metrics"
+)
+
+type EmailConfig struct {
+	Name     string        `yaml:"name"`
+	Host     string        `yaml:"host"`               // SMTP 中继地址
+	Port     int           `yaml:"port"`               // 默认 587
+	Username string        `yaml:"username,omitempty"` // 为空时不认证
+	Password string        `yaml:"password,omitempty"`
+	From     string        `yaml:"from"`
+	To       []string      `yaml:"to"`
+	StartTLS bool          `yaml:"starttls"`           // 要求 STARTTLS；为 false 时若服务器支持仍会尝试
+	Insecure bool          `yaml:"insecure,omitempty"` // 跳过证书校验（仅用于内网自签名中继）
+	Events   []string      `yaml:"events,omitempty"`   // 订阅的事件类型，默认 firing + resolved
+	Digest   time.Duration `yaml:"digest"`             // >0 时开启摘要模式：每隔该时长把期间的事件合并为一封邮件
+	Timeout  time.Duration `yaml:"timeout"`            // 连接超时，默认 10s
+}
+
+type emailChannel struct {
+	cfg   EmailConfig
+	queue chan metrics.AlertEvent
+	done  chan struct{}
+
+	pending []Message // 摘要模式下等待合并发送的事件，仅发送协程访问
+}
+
+// normalizeEmail 校验配置并补齐默认值
+func normalizeEmail(c EmailConfig) (EmailConfig, error) {
+	if c.Host == "" {
+		return c, errors.New("host is required")
+	}
+	if c.From == "" || len(c.To) == 0 {
+		return c, errors.New("from and to are required")
+	}
+	if c.Port == 0 {
+		c.Port = 587
+	}
+	if c.Name == "" {
+		c.Name = "smtp://" + net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 10 * time.Second
+	}
+	if c.Digest < 0 {
+		return c, errors.New("digest must not be negative")
+	}
+	return c, nil
+}
+
+func newEmail(c EmailConfig) (*emailChannel, error) {
+	c, err := normalizeEmail(c)
+	if err != nil {
+		return nil, err
+	}
+	e := &emailChannel{
+		cfg:   c,
+		queue: make(chan metrics.AlertEvent, 100),
+		done:  make(chan struct{}),
+	}
+	go e.run()
+	return e, nil
+}
+
+func (e *emailChannel) Name() string { return e.cfg.Name }
+
+func (e *emailChannel) Notify(ev metrics.AlertEvent) {
+	if !wantEvent(e.cfg.Events, ev.Type) {
+		return
+	}
+	select {
+	case e.queue <- ev:
+	default:
+		fmt.Printf("[WARN] Email %s queue full, dropping %s event for %s\n", e.cfg.Name, ev.Type, ev.Alert.ID)
+	}
+}
+
+func (e *emailChannel) stop() { close(e.done) }
+
+func (e *emailChannel) run() {
+	var tick <-chan time.Time
+	if e.cfg.Digest > 0 {
+		t := time.NewTicker(e.cfg.Digest)
+		defer t.Stop()
+		tick = t.C
+	}
+	for {
+		select {
+		case ev := <-e.queue:
+			msg := newMessage(ev)
+			if e.cfg.Digest > 0 {
+				e.pending = append(e.pending, msg)
+				continue
+			}
+			e.sendLogged(msg.Summary, renderSingle(msg))
+		case <-tick:
+			e.flushDigest()
+		case <-e.done:
+			for {
+				select {
+				case ev := <-e.queue:
+					e.pending = append(e.pending, newMessage(ev))
+				default:
+					e.flushDigest()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (e *emailChannel) flushDigest() {
+	batch := e.pending
+	e.pending = nil
+	if len(batch) == 0 {
+		return
+	}
+	subject := fmt.Sprintf("[告警摘要] %s: 最近 %s 内 %d 条告警事件", batch[0].Host, e.cfg.Digest, len(batch))
+	e.sendLogged(subject, renderDigest(batch))
+}
+
+func (e *emailChannel) sendLogged(subject, body string) {
+	if err := e.send(subject, body); err != nil {
+		fmt.Printf("[ERROR] Email %s failed: %v\n", e.cfg.Name, err)
+	}
+}
+
+func renderSingle(m Message) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n\n", m.Summary)
+	writeAlertDetail(&b, m)
+	return b.String()
+}
+
+func renderDigest(batch []Message) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "共 %d 条告警事件：\n\n", len(batch))
+	for i, m := range batch {
+		fmt.Fprintf(&b, "%d. %s\n", i+1, m.Summary)
+	}
+	b.WriteString("\n详情：\n")
+	for _, m := range batch {
+		b.WriteString("\n----------------------------------------\n")
+		writeAlertDetail(&b, m)
+	}
+	return b.String()
+}
+
+func writeAlertDetail(b *strings.Builder, m Message) {
+	a := m.Alert
+	fmt.Fprintf(b, "事件:     %s\n", m.Type)
+	fmt.Fprintf(b, "主机:     %s\n", m.Host)
+	fmt.Fprintf(b, "告警 ID:  %s\n", a.ID)
+	fmt.Fprintf(b, "规则:     %s\n", a.Rule)
+	fmt.Fprintf(b, "级别:     %s\n", a.Level)
+	fmt.Fprintf(b, "描述:     %s\n", a.Text)
+	if len(a.Labels) > 0 {
+		fmt.Fprintf(b, "标签:     %s\n", joinLabels(a.Labels))
+	}
+	fmt.Fprintf(b, "开始时间: %s\n", formatUnix(a.StartsAt))
+	if a.ResolvedAt > 0 {
+		fmt.Fprintf(b, "恢复时间: %s\n", formatUnix(a.ResolvedAt))
+	}
+	if a.AckedAt > 0 {
+		fmt.Fprintf(b, "确认:     %s %s\n", a.AckedBy, formatUnix(a.AckedAt))
+	}
+}
+
+// send 通过 SMTP 中继发送一封纯文本邮件
+func (e *emailChannel) send(subject, body string) error {
+	addr := net.JoinHostPort(e.cfg.Host, strconv.Itoa(e.cfg.Port))
+	conn, err := net.DialTimeout("tcp", addr, e.cfg.Timeout)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(e.cfg.Timeout * 3))
+	c, err := smtp.NewClient(conn, e.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: e.cfg.Host, InsecureSkipVerify: e.cfg.Insecure}); err != nil {
+			return fmt.Errorf("starttls: %w", err)
+		}
+	} else if e.cfg.StartTLS {
+		return errors.New("server does not support STARTTLS")
+	}
+	if e.cfg.Username != "" {
+		// PlainAuth 只允许在 TLS 或 localhost 上发送密码
+		if err := c.Auth(smtp.PlainAuth("", e.cfg.Username, e.cfg.Password, e.cfg.Host)); err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+	}
+	if err := c.Mail(e.cfg.From); err != nil {
+		return err
+	}
+	for _, to := range e.cfg.To {
+		if err := c.Rcpt(to); err != nil {
+			return fmt.Errorf("rcpt %s: %w", to, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(buildMail(e.cfg.From, e.cfg.To, subject, body)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func buildMail(from string, to []string, subject, body string) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.BEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return b.Bytes()
+}
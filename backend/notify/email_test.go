@@ -0,0 +1,266 @@
+package notify
+
+import (
+	"bufio"
+	"mime"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"system-monitor/metrics"
+)
+
+// fakeSMTP 是只实现发信所需命令的 SMTP 服务器，收到的每封邮件发送到 mails
+type fakeSMTP struct {
+	host     string
+	port     int
+	starttls bool // 是否在 EHLO 中声明 STARTTLS
+	mails    chan fakeMail
+}
+
+type fakeMail struct {
+	from string
+	to   []string
+	data string
+}
+
+func startFakeSMTP(t *testing.T, starttls bool) *fakeSMTP {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	s := &fakeSMTP{host: host, starttls: starttls, mails: make(chan fakeMail, 10)}
+	s.port, _ = strconv.Atoi(port)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+	reply("220 fake ESMTP")
+	var m fakeMail
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch cmd {
+		case "EHLO", "HELO":
+			if s.starttls {
+				reply("250-fake")
+				reply("250 STARTTLS")
+			} else {
+				reply("250 fake")
+			}
+		case "MAIL":
+			m = fakeMail{from: strings.Trim(line[len("MAIL FROM:"):], "<>")}
+			reply("250 OK")
+		case "RCPT":
+			m.to = append(m.to, strings.Trim(line[len("RCPT TO:"):], "<>"))
+			reply("250 OK")
+		case "DATA":
+			reply("354 go ahead")
+			var b strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				b.WriteString(l)
+			}
+			m.data = b.String()
+			s.mails <- m
+			reply("250 OK")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func (s *fakeSMTP) config() EmailConfig {
+	return EmailConfig{
+		Host:    s.host,
+		Port:    s.port,
+		From:    "monitor@example.com",
+		To:      []string{"a@example.com", "b@example.com"},
+		Timeout: time.Second,
+	}
+}
+
+func (s *fakeSMTP) wait(t *testing.T) fakeMail {
+	t.Helper()
+	select {
+	case m := <-s.mails:
+		return m
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for mail")
+	}
+	return fakeMail{}
+}
+
+// mailSubject 解码邮件头中的 Subject
+func mailSubject(t *testing.T, data string) string {
+	t.Helper()
+	for _, line := range strings.Split(data, "\r\n") {
+		if v, ok := strings.CutPrefix(line, "Subject: "); ok {
+			s, err := new(mime.WordDecoder).DecodeHeader(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return s
+		}
+	}
+	t.Fatalf("no Subject header in %q", data)
+	return ""
+}
+
+func TestBuildMail(t *testing.T) {
+	b := string(buildMail("monitor@example.com", []string{"a@example.com", "b@example.com"}, "[告警] CPU 使用率过高", "第一行\n第二行"))
+	for _, want := range []string{
+		"From: monitor@example.com\r\n",
+		"To: a@example.com, b@example.com\r\n",
+		"Content-Type: text/plain; charset=utf-8\r\n",
+		"\r\n\r\n第一行\r\n第二行",
+	} {
+		if !strings.Contains(b, want) {
+			t.Errorf("mail missing %q:\n%s", want, b)
+		}
+	}
+	if got := mailSubject(t, b); got != "[告警] CPU 使用率过高" {
+		t.Errorf("subject = %q", got)
+	}
+}
+
+func TestEmailSend(t *testing.T) {
+	srv := startFakeSMTP(t, false)
+	e := &emailChannel{cfg: srv.config()}
+	if err := e.send("测试主题", "正文"); err != nil {
+		t.Fatal(err)
+	}
+	m := srv.wait(t)
+	if m.from != "monitor@example.com" {
+		t.Errorf("from = %q", m.from)
+	}
+	if strings.Join(m.to, ",") != "a@example.com,b@example.com" {
+		t.Errorf("to = %v", m.to)
+	}
+	if got := mailSubject(t, m.data); got != "测试主题" {
+		t.Errorf("subject = %q", got)
+	}
+	if !strings.HasSuffix(m.data, "\r\n\r\n正文\r\n") {
+		t.Errorf("body = %q", m.data)
+	}
+}
+
+func TestEmailStartTLSRequired(t *testing.T) {
+	srv := startFakeSMTP(t, false)
+	c := srv.config()
+	c.StartTLS = true
+	e := &emailChannel{cfg: c}
+	err := e.send("subject", "body")
+	if err == nil || !strings.Contains(err.Error(), "does not support STARTTLS") {
+		t.Fatalf("err = %v, want STARTTLS error", err)
+	}
+	select {
+	case m := <-srv.mails:
+		t.Fatalf("mail sent without STARTTLS: %q", m.data)
+	default:
+	}
+}
+
+func TestEmailImmediate(t *testing.T) {
+	srv := startFakeSMTP(t, false)
+	e, err := newEmail(srv.config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.stop()
+	e.Notify(testEvent(metrics.AlertAcknowledged, "a1", "忽略"))
+	e.Notify(testEvent(metrics.AlertFiring, "a2", "CPU 使用率过高：95.2%"))
+	m := srv.wait(t)
+	if got := mailSubject(t, m.data); !strings.HasPrefix(got, "[告警][critical]") || !strings.HasSuffix(got, "CPU 使用率过高：95.2%") {
+		t.Errorf("subject = %q", got)
+	}
+	if !strings.Contains(m.data, "告警 ID:  a2") {
+		t.Errorf("body missing alert id: %q", m.data)
+	}
+}
+
+func TestEmailDigest(t *testing.T) {
+	srv := startFakeSMTP(t, false)
+	c := srv.config()
+	c.Digest = 300 * time.Millisecond
+	e, err := newEmail(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Notify(testEvent(metrics.AlertFiring, "d1", "CPU 使用率过高"))
+	e.Notify(testEvent(metrics.AlertFiring, "d2", "内存使用率过高"))
+	e.Notify(testEvent(metrics.AlertResolved, "d1", "CPU 使用率过高"))
+
+	m := srv.wait(t)
+	if got := mailSubject(t, m.data); !strings.Contains(got, "3 条告警事件") {
+		t.Errorf("subject = %q", got)
+	}
+	for _, want := range []string{"1. [告警]", "2. [告警]", "3. [恢复]", "告警 ID:  d2"} {
+		if !strings.Contains(m.data, want) {
+			t.Errorf("digest missing %q", want)
+		}
+	}
+
+	// 停止时把未到摘要周期的事件合并发出
+	e.Notify(testEvent(metrics.AlertFiring, "d3", "磁盘使用率过高"))
+	time.Sleep(50 * time.Millisecond)
+	e.stop()
+	m = srv.wait(t)
+	if got := mailSubject(t, m.data); !strings.Contains(got, "1 条告警事件") {
+		t.Errorf("subject on stop = %q", got)
+	}
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     EmailConfig
+		wantErr bool
+	}{
+		{"ok", EmailConfig{Host: "smtp.example.com", From: "a@x", To: []string{"b@x"}}, false},
+		{"no host", EmailConfig{From: "a@x", To: []string{"b@x"}}, true},
+		{"no to", EmailConfig{Host: "smtp.example.com", From: "a@x"}, true},
+		{"negative digest", EmailConfig{Host: "smtp.example.com", From: "a@x", To: []string{"b@x"}, Digest: -time.Second}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := normalizeEmail(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (c.Port != 587 || c.Name != "smtp://smtp.example.com:587" || c.Timeout != 10*time.Second) {
+				t.Errorf("defaults not applied: %+v", c)
+			}
+		})
+	}
+}
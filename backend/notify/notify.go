@@ -0,0 +1,149 @@
+package notify
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"system-monitor/metrics"
+)
+
+// 告警通知：订阅 metrics 的告警事件，按配置分发到各通知渠道。
+// 每个渠道有自己的队列与发送协程，采集协程只负责入队，不会被慢速接收端阻塞。
+
+type Config struct {
+	Webhooks []WebhookConfig `yaml:"webhooks"`
+	Email    []EmailConfig   `yaml:"email"`
+}
+
+// Channel 是一个通知渠道，Notify 必须立即返回
+type Channel interface {
+	Name() string
+	Notify(ev metrics.AlertEvent)
+}
+
+var (
+	mu       sync.RWMutex
+	channels []Channel
+)
+
+// Init 订阅告警事件，需在采集开始前调用；渠道由 Apply 按配置创建
+func Init() {
+	metrics.OnAlertEvent(dispatch)
+}
+
+// Validate 只校验配置，不创建渠道
+func (c Config) Validate() error {
+	for i, wc := range c.Webhooks {
+		if _, _, err := normalizeWebhook(wc); err != nil {
+			return fmt.Errorf("webhook #%d (%s): %w", i+1, wc.Name, err)
+		}
+	}
+	for i, ec := range c.Email {
+		if _, err := normalizeEmail(ec); err != nil {
+			return fmt.Errorf("email #%d (%s): %w", i+1, ec.Name, err)
+		}
+	}
+	return nil
+}
+
+// Apply 校验配置并替换全部渠道，旧渠道队列中的消息会继续发送完毕
+func Apply(c Config) error {
+	var next []Channel
+	for i, wc := range c.Webhooks {
+		w, err := newWebhook(wc)
+		if err != nil {
+			stopAll(next)
+			return fmt.Errorf("webhook #%d (%s): %w", i+1, wc.Name, err)
+		}
+		next = append(next, w)
+	}
+	for i, ec := range c.Email {
+		e, err := newEmail(ec)
+		if err != nil {
+			stopAll(next)
+			return fmt.Errorf("email #%d (%s): %w", i+1, ec.Name, err)
+		}
+		next = append(next, e)
+	}
+	mu.Lock()
+	old := channels
+	channels = next
+	mu.Unlock()
+	stopAll(old)
+	return nil
+}
+
+func stopAll(list []Channel) {
+	for _, ch := range list {
+		if s, ok := ch.(interface{ stop() }); ok {
+			s.stop()
+		}
+	}
+}
+
+func dispatch(ev metrics.AlertEvent) {
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, ch := range channels {
+		ch.Notify(ev)
+	}
+}
+
+func wantEvent(events []string, typ string) bool {
+	if len(events) == 0 {
+		return typ == metrics.AlertFiring || typ == metrics.AlertResolved
+	}
+	for _, e := range events {
+		if e == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// Message 是渲染通知内容时可用的数据
+type Message struct {
+	Type    string            // firing / acknowledged / resolved
+	Alert   metrics.AlertInfo // 告警事件
+	Host    string            // 本机主机名
+	Summary string            // 一行摘要，如 "[告警][critical] web-01: CPU 使用率过高：95.2%"
+}
+
+func newMessage(ev metrics.AlertEvent) Message {
+	metrics.Mu.RLock()
+	host := metrics.Latest.System.Hostname
+	metrics.Mu.RUnlock()
+
+	tag := "告警"
+	switch ev.Type {
+	case metrics.AlertResolved:
+		tag = "恢复"
+	case metrics.AlertAcknowledged:
+		tag = "已确认"
+	}
+	return Message{
+		Type:    ev.Type,
+		Alert:   ev.Alert,
+		Host:    host,
+		Summary: fmt.Sprintf("[%s][%s] %s: %s", tag, ev.Alert.Level, host, ev.Alert.Text),
+	}
+}
+
+func formatUnix(ts int64) string {
+	if ts == 0 {
+		return "-"
+	}
+	return time.Unix(ts, 0).Format("2006-01-02 15:04:05")
+}
+
+func joinLabels(labels map[string]string) string {
+	parts := make([]string, 0, len(labels))
+	for k, v := range labels {
+		parts = append(parts, k+"="+v)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,218 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"system-monitor/metrics"
+)
+
+type WebhookConfig struct {
+	Name       string            `yaml:"name"`
+	URL        string            `yaml:"url"`
+	Format     string            `yaml:"format"`             // generic（默认）/ slack / dingtalk / wecom
+	Template   string            `yaml:"template,omitempty"` // 自定义请求体（text/template），优先于 format
+	Headers    map[string]string `yaml:"headers,omitempty"`  // 额外请求头
+	Events     []string          `yaml:"events,omitempty"`   // 订阅的事件类型，默认 firing + resolved
+	MaxRetries int               `yaml:"max_retries"`        // 失败重试次数，默认 3
+	Backoff    time.Duration     `yaml:"backoff"`            // 首次重试等待，之后指数翻倍，默认 1s
+	RateLimit  int               `yaml:"rate_limit"`         // 每分钟最多发送条数，0 表示不限
+	Timeout    time.Duration     `yaml:"timeout"`            // 单次请求超时，默认 5s
+}
+
+// 预置的请求体模板，分别对应通用 JSON、Slack incoming webhook、钉钉 / 企业微信机器人
+var presetTemplates = map[string]string{
+	"generic":  `{"type":{{json .Type}},"host":{{json .Host}},"summary":{{json .Summary}},"alert":{{json .Alert}}}`,
+	"slack":    `{"text":{{json .Summary}}}`,
+	"dingtalk": `{"msgtype":"text","text":{"content":{{json .Summary}}}}`,
+	"wecom":    `{"msgtype":"text","text":{"content":{{json .Summary}}}}`,
+}
+
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"time":   formatUnix,
+	"labels": joinLabels,
+}
+
+type webhook struct {
+	cfg    WebhookConfig
+	tmpl   *template.Template
+	client *http.Client
+	queue  chan metrics.AlertEvent
+	done   chan struct{}
+
+	tokens     float64
+	lastRefill time.Time
+}
+
+// normalizeWebhook 校验配置、补齐默认值并编译请求体模板
+func normalizeWebhook(c WebhookConfig) (WebhookConfig, *template.Template, error) {
+	if c.URL == "" {
+		return c, nil, errors.New("url is required")
+	}
+	if !strings.HasPrefix(c.URL, "http://") && !strings.HasPrefix(c.URL, "https://") {
+		return c, nil, fmt.Errorf("url must be http(s), got %q", c.URL)
+	}
+	if c.Name == "" {
+		c.Name = c.URL
+	}
+	if c.Format == "" {
+		c.Format = "generic"
+	}
+	src := c.Template
+	if src == "" {
+		var ok bool
+		if src, ok = presetTemplates[c.Format]; !ok {
+			return c, nil, fmt.Errorf("unknown format %q", c.Format)
+		}
+	}
+	tmpl, err := template.New(c.Name).Funcs(templateFuncs).Parse(src)
+	if err != nil {
+		return c, nil, err
+	}
+	if c.MaxRetries < 0 {
+		return c, nil, errors.New("max_retries must not be negative")
+	}
+	if c.MaxRetries == 0 {
+		c.MaxRetries = 3
+	}
+	if c.Backoff <= 0 {
+		c.Backoff = time.Second
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 5 * time.Second
+	}
+	return c, tmpl, nil
+}
+
+func newWebhook(c WebhookConfig) (*webhook, error) {
+	c, tmpl, err := normalizeWebhook(c)
+	if err != nil {
+		return nil, err
+	}
+	w := &webhook{
+		cfg:        c,
+		tmpl:       tmpl,
+		client:     &http.Client{Timeout: c.Timeout},
+		queue:      make(chan metrics.AlertEvent, 100),
+		done:       make(chan struct{}),
+		tokens:     float64(c.RateLimit),
+		lastRefill: time.Now(),
+	}
+	go w.run()
+	return w, nil
+}
+
+func (w *webhook) Name() string { return w.cfg.Name }
+
+func (w *webhook) Notify(ev metrics.AlertEvent) {
+	if !wantEvent(w.cfg.Events, ev.Type) {
+		return
+	}
+	select {
+	case w.queue <- ev:
+	default:
+		fmt.Printf("[WARN] Webhook %s queue full, dropping %s event for %s\n", w.cfg.Name, ev.Type, ev.Alert.ID)
+	}
+}
+
+func (w *webhook) stop() { close(w.done) }
+
+func (w *webhook) run() {
+	for {
+		select {
+		case ev := <-w.queue:
+			w.waitToken()
+			if err := w.deliver(ev); err != nil {
+				fmt.Printf("[ERROR] Webhook %s failed for alert %s: %v\n", w.cfg.Name, ev.Alert.ID, err)
+			}
+		case <-w.done:
+			// 渠道被替换：把已入队的消息发完再退出
+			for {
+				select {
+				case ev := <-w.queue:
+					w.deliver(ev)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// waitToken 令牌桶限流：每分钟补充 RateLimit 个令牌，没有令牌时等待
+func (w *webhook) waitToken() {
+	if w.cfg.RateLimit <= 0 {
+		return
+	}
+	rate := float64(w.cfg.RateLimit) / float64(time.Minute)
+	for {
+		now := time.Now()
+		w.tokens += float64(now.Sub(w.lastRefill)) * rate
+		if max := float64(w.cfg.RateLimit); w.tokens > max {
+			w.tokens = max
+		}
+		w.lastRefill = now
+		if w.tokens >= 1 {
+			w.tokens--
+			return
+		}
+		time.Sleep(time.Duration((1 - w.tokens) / rate))
+	}
+}
+
+func (w *webhook) deliver(ev metrics.AlertEvent) error {
+	var body bytes.Buffer
+	if err := w.tmpl.Execute(&body, newMessage(ev)); err != nil {
+		return fmt.Errorf("render template: %w", err)
+	}
+	backoff := w.cfg.Backoff
+	var err error
+	for attempt := 0; attempt <= w.cfg.MaxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			if backoff *= 2; backoff > time.Minute {
+				backoff = time.Minute
+			}
+		}
+		var retry bool
+		if retry, err = w.post(body.Bytes()); err == nil || !retry {
+			return err
+		}
+	}
+	return err
+}
+
+// post 发送一次请求，返回是否值得重试
+func (w *webhook) post(body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, w.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("unexpected status %s", resp.Status)
+	// 4xx 多为配置错误，重试无意义；429 与 5xx 重试
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, err
+}
@@ -0,0 +1,187 @@
+package notify
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"system-monitor/metrics"
+)
+
+func testEvent(typ, id, text string) metrics.AlertEvent {
+	return metrics.AlertEvent{Type: typ, Alert: metrics.AlertInfo{ID: id, Level: "critical", Text: text, Rule: "cpu_high", StartsAt: 1700000000}}
+}
+
+func TestWebhookRetry(t *testing.T) {
+	tests := []struct {
+		name      string
+		statuses  []int // 依次返回的状态码，用完后返回最后一个
+		wantCalls int32
+		wantErr   bool
+	}{
+		{"success", []int{http.StatusOK}, 1, false},
+		{"retry 5xx then succeed", []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusNoContent}, 3, false},
+		{"retry 429", []int{http.StatusTooManyRequests, http.StatusOK}, 2, false},
+		{"no retry on 4xx", []int{http.StatusBadRequest}, 1, true},
+		{"give up after max_retries", []int{http.StatusInternalServerError}, 3, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(calls.Add(1)) - 1
+				w.WriteHeader(tt.statuses[min(n, len(tt.statuses)-1)])
+			}))
+			defer srv.Close()
+
+			c, tmpl, err := normalizeWebhook(WebhookConfig{URL: srv.URL, MaxRetries: 2, Backoff: time.Millisecond})
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := &webhook{cfg: c, tmpl: tmpl, client: srv.Client()}
+			err = w.deliver(testEvent(metrics.AlertFiring, "w1", "CPU 使用率过高"))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestWebhookPayload(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		body   []byte
+		header http.Header
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		body, _ = io.ReadAll(r.Body)
+		header = r.Header.Clone()
+	}))
+	defer srv.Close()
+
+	c, tmpl, err := normalizeWebhook(WebhookConfig{URL: srv.URL, Format: "dingtalk", Headers: map[string]string{"X-Token": "secret"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &webhook{cfg: c, tmpl: tmpl, client: srv.Client()}
+	if err := w.deliver(testEvent(metrics.AlertResolved, "w2", "内存使用率过高")); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	var got struct {
+		MsgType string `json:"msgtype"`
+		Text    struct {
+			Content string `json:"content"`
+		} `json:"text"`
+	}
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("invalid json %q: %v", body, err)
+	}
+	if got.MsgType != "text" || got.Text.Content != "[恢复][critical] : 内存使用率过高" {
+		t.Errorf("payload = %s", body)
+	}
+	if header.Get("X-Token") != "secret" || header.Get("Content-Type") != "application/json" {
+		t.Errorf("headers = %v", header)
+	}
+}
+
+func TestWebhookRateLimit(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		times []time.Time
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		times = append(times, time.Now())
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	// 每分钟 600 条：桶内 600 个令牌，之后每 100ms 补充一个
+	w, err := newWebhook(WebhookConfig{URL: srv.URL, RateLimit: 600})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.tokens = 1 // 模拟令牌已基本用完
+	for i := range 3 {
+		w.Notify(testEvent(metrics.AlertFiring, "r"+strconv.Itoa(i), "CPU 使用率过高"))
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		mu.Lock()
+		n := len(times)
+		mu.Unlock()
+		if n == 3 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	w.stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(times) != 3 {
+		t.Fatalf("delivered %d events, want 3", len(times))
+	}
+	// 第一条使用剩余令牌立即发送，之后两条各等待约 100ms
+	if d := times[2].Sub(times[0]); d < 150*time.Millisecond {
+		t.Errorf("3 events delivered within %s, rate limit not applied", d)
+	}
+}
+
+func TestWebhookEvents(t *testing.T) {
+	tests := []struct {
+		events []string
+		typ    string
+		want   bool
+	}{
+		{nil, metrics.AlertFiring, true},
+		{nil, metrics.AlertResolved, true},
+		{nil, metrics.AlertAcknowledged, false},
+		{[]string{metrics.AlertAcknowledged}, metrics.AlertAcknowledged, true},
+		{[]string{metrics.AlertAcknowledged}, metrics.AlertFiring, false},
+	}
+	for _, tt := range tests {
+		if got := wantEvent(tt.events, tt.typ); got != tt.want {
+			t.Errorf("wantEvent(%v, %q) = %v, want %v", tt.events, tt.typ, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeWebhook(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     WebhookConfig
+		wantErr bool
+	}{
+		{"defaults", WebhookConfig{URL: "https://hooks.example.com/x"}, false},
+		{"no url", WebhookConfig{}, true},
+		{"bad scheme", WebhookConfig{URL: "ftp://example.com"}, true},
+		{"unknown format", WebhookConfig{URL: "https://example.com", Format: "teams"}, true},
+		{"bad template", WebhookConfig{URL: "https://example.com", Template: "{{.Summary"}, true},
+		{"negative retries", WebhookConfig{URL: "https://example.com", MaxRetries: -1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _, err := normalizeWebhook(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (c.Format != "generic" || c.MaxRetries != 3 || c.Backoff != time.Second || c.Timeout != 5*time.Second) {
+				t.Errorf("defaults not applied: %+v", c)
+			}
+		})
+	}
+}
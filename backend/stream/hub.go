@@ -0,0 +1,374 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"system-monitor/lan"
+	"system-monitor/metrics"
+)
+
+// SSE 广播中心：每个采集周期只序列化一次数据，再分发给所有订阅者。
+// 每个订阅者有固定长度的缓冲区，缓冲区满（客户端读取过慢）时直接断开该客户端，
+// 避免拖慢采集协程或无限占用内存。
+//
+// 订阅分两种：
+//   - 未指定主题：每个周期推送完整的 dashboard 事件（完整版与去掉审计数据的版本各序列化一次，
+//     且只在有对应订阅者时生成）。
+//   - 指定主题（见 topics.go）：状态类主题只在内容变化时推送整段数据；告警与网络审计日志
+//     以追加事件推送，并带有事件 ID，断线重连时按 Last-Event-ID 补发错过的事件。
+
+// bufferSize 为每个客户端最多积压的消息数（不含连接时的初始数据）
+const bufferSize = 8
+
+// ringSize 为保留用于重连补发的追加事件数
+const ringSize = 1024
+
+// Message 是一条推送事件，SSE 与 WebSocket 的编码各自只在首次需要时生成一次
+type Message struct {
+	ID    string          // 追加事件的 ID，状态事件为空
+	Event string          // 事件名
+	Topic string          // 所属主题，dashboard 事件为空
+	Data  json.RawMessage // JSON 数据
+
+	sseOnce, wsOnce sync.Once
+	sse, ws         []byte
+}
+
+func newMessage(id, event, topic string, v interface{}) *Message {
+	b, err := json.Marshal(v)
+	if err != nil {
+		fmt.Println("[ERROR] stream marshal:", err)
+		return nil
+	}
+	return &Message{ID: id, Event: event, Topic: topic, Data: b}
+}
+
+// SSE 返回完整的 SSE 消息，无 ID 时不带 id 行
+func (m *Message) SSE() []byte {
+	m.sseOnce.Do(func() {
+		var buf bytes.Buffer
+		buf.Grow(len(m.Data) + len(m.ID) + len(m.Event) + 24)
+		if m.ID != "" {
+			buf.WriteString("id: " + m.ID + "\n")
+		}
+		buf.WriteString("event: " + m.Event + "\ndata: ")
+		buf.Write(m.Data)
+		buf.WriteString("\n\n")
+		m.sse = buf.Bytes()
+	})
+	return m.sse
+}
+
+// JSON 返回 WebSocket 文本帧：{"event": ..., "id": ..., "data": ...}
+func (m *Message) JSON() []byte {
+	m.wsOnce.Do(func() {
+		m.ws, _ = json.Marshal(wsEnvelope{Event: m.Event, ID: m.ID, Data: m.Data})
+	})
+	return m.ws
+}
+
+type wsEnvelope struct {
+	Event string          `json:"event"`
+	ID    string          `json:"id,omitempty"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// Subscriber 是一个 SSE / WebSocket 客户端
+type Subscriber struct {
+	audit  bool            // 是否接收安全审计数据（net_log / geo_heat、局域网主机的服务探测结果）
+	topics map[string]bool // 为 nil 时按周期推送完整 dashboard
+	ch     chan *Message
+	done   chan struct{} // 被中心断开时关闭
+	once   sync.Once
+}
+
+// C 返回待发送的事件
+func (s *Subscriber) C() <-chan *Message { return s.ch }
+
+// Done 在客户端因过慢被断开时关闭
+func (s *Subscriber) Done() <-chan struct{} { return s.done }
+
+func (s *Subscriber) kick() {
+	s.once.Do(func() { close(s.done) })
+}
+
+// appendEvent 是一条可补发的追加事件
+type appendEvent struct {
+	seq uint64
+	msg *Message
+}
+
+type hub struct {
+	mu        sync.Mutex
+	subs      map[*Subscriber]struct{}
+	lastFull  *Message // 最近一帧 dashboard，新订阅者连接时立即发送
+	lastBasic *Message
+	dropped   atomic.Uint64
+
+	epoch  string                // 进程启动标识，用于识别服务重启前的事件 ID
+	seq    uint64                // 最近一条追加事件的序号
+	ring   []appendEvent         // 最近的追加事件，序号连续
+	state  map[string][]byte     // 各状态主题最近推送的内容，用于判断是否变化
+	netLog []metrics.NetLogEntry // 与追加事件保持一致的审计日志副本，作为 netlog 主题的初始数据
+}
+
+var h = &hub{
+	subs:  make(map[*Subscriber]struct{}),
+	epoch: strconv.FormatInt(time.Now().Unix(), 36),
+	state: make(map[string][]byte),
+}
+
+// Init 订阅采集、告警、审计日志与局域网扫描事件并注册客户端数指标，需在采集开始前调用
+func Init() {
+	metrics.OnCollect(h.publish)
+	metrics.OnAlertEvent(func(ev metrics.AlertEvent) {
+		h.appendEvent("alerts", "alert", ev)
+	})
+	metrics.OnNetLog(h.publishNetLog)
+	lan.OnScan(h.publishLAN)
+	metrics.RegisterGauge("stream_clients", "Connected SSE clients.", func() float64 {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		return float64(len(h.subs))
+	})
+	metrics.RegisterCounter("stream_dropped_clients", "SSE clients disconnected for reading too slowly.", func() float64 {
+		return float64(h.dropped.Load())
+	})
+}
+
+// Subscribe 注册一个按周期接收完整 dashboard 的客户端；audit 为 false 时推送的数据不含安全审计字段
+func Subscribe(audit bool) *Subscriber {
+	s := &Subscriber{audit: audit, ch: make(chan *Message, bufferSize), done: make(chan struct{})}
+	h.mu.Lock()
+	h.subs[s] = struct{}{}
+	last := h.lastBasic
+	if audit {
+		last = h.lastFull
+	}
+	if last != nil {
+		s.ch <- last
+	}
+	h.mu.Unlock()
+	return s
+}
+
+// SubscribeTopics 注册一个按主题接收增量数据的客户端。lastEventID 为浏览器重连时携带的
+// Last-Event-ID：若错过的追加事件仍在缓存中则只补发这些事件，否则发送各主题的完整数据。
+// 状态类主题总是先发送一次当前数据。调用方需确保审计主题只对有权限的客户端开放；
+// audit 为 false 时 lan 主题推送去掉服务探测结果的版本。
+func SubscribeTopics(topics []string, lastEventID string, audit bool) *Subscriber {
+	set := make(map[string]bool, len(topics))
+	for _, t := range topics {
+		set[t] = true
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	initial := h.initialFrames(set, lastEventID, audit)
+	s := &Subscriber{
+		audit:  audit,
+		topics: set,
+		// 预留 len(Topics) 个位置给 SetTopics 新增主题时的初始数据
+		ch:   make(chan *Message, len(initial)+bufferSize+len(Topics)),
+		done: make(chan struct{}),
+	}
+	for _, f := range initial {
+		s.ch <- f
+	}
+	h.subs[s] = struct{}{}
+	return s
+}
+
+// SetTopics 修改订阅的主题，新增的主题会先收到一次完整数据
+func SetTopics(s *Subscriber, topics []string) {
+	set := make(map[string]bool, len(topics))
+	added := make(map[string]bool)
+	for _, t := range topics {
+		set[t] = true
+		if !s.topics[t] {
+			added[t] = true
+		}
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s.topics = set
+	if _, ok := h.subs[s]; !ok {
+		return
+	}
+	for _, m := range h.initialFrames(added, "", s.audit) {
+		h.deliver(s, m)
+	}
+}
+
+// Unsubscribe 在客户端断开时调用
+func Unsubscribe(s *Subscriber) {
+	h.mu.Lock()
+	delete(h.subs, s)
+	h.mu.Unlock()
+}
+
+func (h *hub) publish(d metrics.DashboardData) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var wantFull, wantBasic, wantTopics bool
+	for s := range h.subs {
+		switch {
+		case s.topics != nil:
+			wantTopics = true
+		case s.audit:
+			wantFull = true
+		default:
+			wantBasic = true
+		}
+	}
+	h.lastFull, h.lastBasic = nil, nil
+	if wantFull {
+		h.lastFull = newMessage("", "dashboard", "", d)
+	}
+	if wantBasic {
+		h.lastBasic = newMessage("", "dashboard", "", d.WithoutAudit())
+	}
+	for s := range h.subs {
+		if s.topics != nil {
+			continue
+		}
+		msg := h.lastBasic
+		if s.audit {
+			msg = h.lastFull
+		}
+		if msg != nil {
+			h.deliver(s, msg)
+		}
+	}
+
+	if !wantTopics {
+		// 没有主题订阅者时不再比较变化，下一个订阅者连接时会先收到完整数据
+		for k := range h.state {
+			if k != "lan" && k != "lan_basic" {
+				delete(h.state, k)
+			}
+		}
+		return
+	}
+	for _, t := range cycleTopics {
+		h.publishState(t, statePayload(t, d))
+	}
+}
+
+// publishState 在内容变化时向订阅了该主题的客户端推送整段数据，调用方需持有 h.mu
+func (h *hub) publishState(topic string, v interface{}) {
+	msg := h.changedState(topic, topic, v)
+	if msg == nil {
+		return
+	}
+	for s := range h.subs {
+		if s.topics[topic] {
+			h.deliver(s, msg)
+		}
+	}
+}
+
+// publishLAN 推送局域网扫描结果：有审计权限的订阅者收到完整结果，其余订阅者收到去掉服务探测结果的版本，
+// 两个版本各自只在内容变化时推送
+func (h *hub) publishLAN(res lan.ScanResult) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	full := h.changedState("lan", "lan", res)
+	basic := h.changedState("lan_basic", "lan", res.WithoutServices())
+	for s := range h.subs {
+		if !s.topics["lan"] {
+			continue
+		}
+		msg := basic
+		if s.audit {
+			msg = full
+		}
+		if msg != nil {
+			h.deliver(s, msg)
+		}
+	}
+}
+
+// changedState 在 v 的编码与 key 下记录的内容不同时保存并返回新事件，未变化或编码失败时返回 nil；调用方需持有 h.mu
+func (h *hub) changedState(key, topic string, v interface{}) *Message {
+	b, err := json.Marshal(v)
+	if err != nil {
+		fmt.Println("[ERROR] stream marshal:", err)
+		return nil
+	}
+	if bytes.Equal(b, h.state[key]) {
+		return nil
+	}
+	h.state[key] = b
+	return &Message{Event: topic, Topic: topic, Data: b}
+}
+
+func (h *hub) publishNetLog(e metrics.NetLogEntry) {
+	h.mu.Lock()
+	h.netLog = append(h.netLog, e)
+	if logCap := metrics.GetConfig().NetLogCap; len(h.netLog) > logCap {
+		h.netLog = h.netLog[len(h.netLog)-logCap:]
+	}
+	h.mu.Unlock()
+	h.appendEvent("netlog", "netlog_entry", e)
+}
+
+// appendEvent 分配事件 ID、写入补发缓存并推送给订阅了该主题的客户端
+func (h *hub) appendEvent(topic, event string, v interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seq++
+	msg := newMessage(h.eventID(h.seq), event, topic, v)
+	if msg == nil {
+		return
+	}
+	h.ring = append(h.ring, appendEvent{seq: h.seq, msg: msg})
+	if len(h.ring) > ringSize {
+		h.ring = h.ring[len(h.ring)-ringSize:]
+	}
+	for s := range h.subs {
+		if s.topics[topic] {
+			h.deliver(s, msg)
+		}
+	}
+}
+
+// deliver 非阻塞地投递一帧，客户端积压过多时将其断开；调用方需持有 h.mu
+func (h *hub) deliver(s *Subscriber, msg *Message) {
+	select {
+	case s.ch <- msg:
+	default:
+		delete(h.subs, s)
+		s.kick()
+		h.dropped.Add(1)
+	}
+}
+
+func (h *hub) eventID(seq uint64) string {
+	return h.epoch + "-" + strconv.FormatUint(seq, 10)
+}
+
+// missedSince 返回 lastEventID 之后的追加事件；无法确定是否有遗漏时返回 false
+func (h *hub) missedSince(lastEventID string) ([]appendEvent, bool) {
+	prefix := h.epoch + "-"
+	if len(lastEventID) <= len(prefix) || lastEventID[:len(prefix)] != prefix {
+		return nil, false // 为空或来自服务重启前
+	}
+	last, err := strconv.ParseUint(lastEventID[len(prefix):], 10, 64)
+	if err != nil || last > h.seq {
+		return nil, false
+	}
+	if last == h.seq {
+		return nil, true
+	}
+	if len(h.ring) == 0 || h.ring[0].seq > last+1 {
+		return nil, false // 错过的事件已被挤出缓存
+	}
+	return h.ring[last+1-h.ring[0].seq:], true
+}
@@ -0,0 +1,194 @@
+package stream
+
+import (
+	"strings"
+	"testing"
+
+	"system-monitor/lan"
+	"system-monitor/metrics"
+)
+
+// resetHub 换上一个空的广播中心，测试结束后恢复
+func resetHub(t *testing.T) {
+	t.Helper()
+	prev := h
+	h = &hub{subs: make(map[*Subscriber]struct{}), epoch: "test", state: make(map[string][]byte)}
+	t.Cleanup(func() { h = prev })
+}
+
+// drain 取出订阅者当前积压的全部事件
+func drain(s *Subscriber) []*Message {
+	var out []*Message
+	for {
+		select {
+		case m := <-s.ch:
+			out = append(out, m)
+		default:
+			return out
+		}
+	}
+}
+
+func TestPublishLANViewerVariant(t *testing.T) {
+	resetHub(t)
+	viewer := SubscribeTopics([]string{"lan"}, "", false)
+	operator := SubscribeTopics([]string{"lan"}, "", true)
+	drain(viewer)
+	drain(operator)
+
+	scan := func(banner string) lan.ScanResult {
+		return lan.ScanResult{Hosts: []lan.Host{{IP: "10.0.0.2", Services: []lan.Service{{Port: 22, Proto: "tcp", Banner: banner}}}}}
+	}
+	h.publishLAN(scan("SSH-2.0-OpenSSH_9.6"))
+	v, o := drain(viewer), drain(operator)
+	if len(v) != 1 || v[0].Event != "lan" || strings.Contains(string(v[0].Data), "services") {
+		t.Fatalf("viewer got %d events", len(v))
+	}
+	if len(o) != 1 || !strings.Contains(string(o[0].Data), "OpenSSH_9.6") {
+		t.Fatalf("operator got %d events", len(o))
+	}
+
+	// 只有服务探测结果变化时，viewer 看到的内容不变，不再推送
+	h.publishLAN(scan("SSH-2.0-OpenSSH_9.7"))
+	if v := drain(viewer); len(v) != 0 {
+		t.Errorf("viewer got %d events for services-only change", len(v))
+	}
+	if o := drain(operator); len(o) != 1 {
+		t.Errorf("operator got %d events, want 1", len(o))
+	}
+}
+
+func TestPublishDashboard(t *testing.T) {
+	resetHub(t)
+	d := metrics.DashboardData{
+		CPU:    metrics.CPUInfo{Usage: 12.5},
+		NetLog: []metrics.NetLogEntry{{Time: "12:00:00", Rx: 500}},
+	}
+	full, basic := Subscribe(true), Subscribe(false)
+	h.publish(d)
+
+	f, b := drain(full), drain(basic)
+	if len(f) != 1 || f[0].Event != "dashboard" || !strings.Contains(string(f[0].Data), "12:00:00") {
+		t.Fatalf("audit subscriber got %d events", len(f))
+	}
+	if len(b) != 1 || strings.Contains(string(b[0].Data), "12:00:00") || !strings.Contains(string(b[0].Data), "12.5") {
+		t.Fatalf("basic subscriber got %d events", len(b))
+	}
+	// 同一帧只序列化一次，SSE 编码在订阅者间共享
+	other := Subscribe(true)
+	if m := drain(other); len(m) != 1 || m[0] != h.lastFull {
+		t.Error("new subscriber did not get the cached frame")
+	}
+	if string(f[0].SSE()) != "event: dashboard\ndata: "+string(f[0].Data)+"\n\n" {
+		t.Errorf("SSE = %q", f[0].SSE())
+	}
+}
+
+func TestSlowSubscriberEvicted(t *testing.T) {
+	resetHub(t)
+	slow := Subscribe(false)
+	fast := Subscribe(false)
+	for i := 0; i < bufferSize+1; i++ {
+		h.publish(metrics.DashboardData{Timestamp: int64(i)})
+		drain(fast)
+	}
+	select {
+	case <-slow.Done():
+	default:
+		t.Fatal("slow subscriber not kicked")
+	}
+	select {
+	case <-fast.Done():
+		t.Fatal("fast subscriber kicked")
+	default:
+	}
+	if _, ok := h.subs[slow]; ok || len(h.subs) != 1 {
+		t.Errorf("subs = %d, slow still registered: %v", len(h.subs), ok)
+	}
+	if n := h.dropped.Load(); n != 1 {
+		t.Errorf("dropped = %d, want 1", n)
+	}
+	// 积压的数据仍可读完，之后不再收到新数据
+	if n := len(drain(slow)); n != bufferSize {
+		t.Errorf("slow backlog = %d, want %d", n, bufferSize)
+	}
+	h.publish(metrics.DashboardData{})
+	if n := len(drain(slow)); n != 0 {
+		t.Errorf("kicked subscriber got %d more events", n)
+	}
+	Unsubscribe(slow) // 重复移除不应出错
+}
+
+// events 返回事件名与 ID，便于比较
+func events(msgs []*Message) []string {
+	out := make([]string, len(msgs))
+	for i, m := range msgs {
+		out[i] = m.Event + "#" + m.ID
+	}
+	return out
+}
+
+func TestLastEventIDReplay(t *testing.T) {
+	resetHub(t)
+	alert := func(id string) metrics.AlertEvent {
+		return metrics.AlertEvent{Type: metrics.AlertFiring, Alert: metrics.AlertInfo{ID: id}}
+	}
+	first := SubscribeTopics([]string{"alerts"}, "", false)
+	if got := events(drain(first)); strings.Join(got, ",") != "alerts#test-0" {
+		t.Fatalf("initial = %v", got)
+	}
+	h.appendEvent("alerts", "alert", alert("a1"))
+	h.appendEvent("netlog", "netlog_entry", metrics.NetLogEntry{Time: "12:00:00"})
+	h.appendEvent("alerts", "alert", alert("a2"))
+	if got := events(drain(first)); strings.Join(got, ",") != "alert#test-1,alert#test-3" {
+		t.Fatalf("live = %v", got)
+	}
+	Unsubscribe(first)
+
+	tests := []struct {
+		name   string
+		lastID string
+		want   string
+	}{
+		{"gap replays only missed events of the topic", "test-1", "alert#test-3"},
+		{"up to date", "test-3", ""},
+		{"unknown epoch sends full list", "old-1", "alerts#test-3"},
+		{"future id sends full list", "test-9", "alerts#test-3"},
+		{"garbage sends full list", "test-x", "alerts#test-3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := SubscribeTopics([]string{"alerts"}, tt.lastID, false)
+			defer Unsubscribe(s)
+			if got := strings.Join(events(drain(s)), ","); got != tt.want {
+				t.Errorf("frames = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplayRingOverflow(t *testing.T) {
+	resetHub(t)
+	total := ringSize + 5
+	for i := 1; i <= total; i++ {
+		h.appendEvent("alerts", "alert", metrics.AlertEvent{Type: metrics.AlertFiring})
+	}
+	if len(h.ring) != ringSize || h.ring[0].seq != 6 {
+		t.Fatalf("ring = %d events from seq %d", len(h.ring), h.ring[0].seq)
+	}
+
+	// 错过的事件仍全部在缓存中：逐条补发
+	s := SubscribeTopics([]string{"alerts"}, "test-5", false)
+	got := drain(s)
+	if len(got) != ringSize || got[0].ID != "test-6" || got[len(got)-1].ID != "test-1029" {
+		t.Errorf("replayed %d events %v..%v", len(got), got[0].ID, got[len(got)-1].ID)
+	}
+	Unsubscribe(s)
+
+	// 有事件已被挤出：改为发送完整列表
+	s = SubscribeTopics([]string{"alerts"}, "test-4", false)
+	if got := events(drain(s)); strings.Join(got, ",") != "alerts#test-1029" {
+		t.Errorf("frames = %v, want full list", got)
+	}
+	Unsubscribe(s)
+}
@@ -0,0 +1,127 @@
+package stream
+
+import (
+	"fmt"
+	"strings"
+
+	"system-monitor/lan"
+	"system-monitor/metrics"
+)
+
+// 可订阅的主题。状态类主题（perf / disks / network / geo / lan）变化时推送同名事件，内容为该部分的完整数据；
+// alerts 与 netlog 为追加类主题：连接时先推送 alerts / netlog 完整列表，之后每条新事件推送一次
+// alert（告警状态变化，按 alert.id 覆盖）/ netlog_entry（新增审计日志）。
+var Topics = []string{"perf", "disks", "network", "alerts", "netlog", "geo", "lan"}
+
+// cycleTopics 是随采集周期更新的状态类主题
+var cycleTopics = []string{"perf", "disks", "network", "geo"}
+
+// AuditTopic 判断主题是否包含安全审计数据。lan 对所有角色开放，无审计权限的订阅者收到去掉服务探测结果的版本
+func AuditTopic(t string) bool {
+	return t == "netlog" || t == "geo"
+}
+
+// ParseTopics 解析逗号分隔的主题列表
+func ParseTopics(s string) ([]string, error) {
+	var out []string
+	seen := make(map[string]bool)
+	for _, t := range strings.Split(s, ",") {
+		t = strings.TrimSpace(t)
+		if t == "" || seen[t] {
+			continue
+		}
+		if !validTopic(t) {
+			return nil, fmt.Errorf("unknown topic %q", t)
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no topics given")
+	}
+	return out, nil
+}
+
+func validTopic(t string) bool {
+	for _, v := range Topics {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
+
+// perfPayload 是 perf 主题的数据：除磁盘、网卡、告警与审计数据外的仪表盘字段
+type perfPayload struct {
+	CPU       metrics.CPUInfo    `json:"cpu"`
+	Memory    metrics.MemoryInfo `json:"memory"`
+	System    metrics.SystemInfo `json:"system"`
+	Perf      metrics.PerfInfo   `json:"perf"`
+	Timestamp int64              `json:"timestamp"`
+}
+
+func statePayload(topic string, d metrics.DashboardData) interface{} {
+	switch topic {
+	case "perf":
+		return perfPayload{CPU: d.CPU, Memory: d.Memory, System: d.System, Perf: d.Perf, Timestamp: d.Timestamp}
+	case "disks":
+		return d.Disk
+	case "network":
+		return d.Network
+	case "geo":
+		return d.GeoHeat
+	}
+	return nil
+}
+
+// initialFrames 生成新订阅者连接时需要的数据，调用方需持有 h.mu
+func (h *hub) initialFrames(topics map[string]bool, lastEventID string, audit bool) []*Message {
+	metrics.Mu.RLock()
+	d := metrics.Latest
+	metrics.Mu.RUnlock()
+
+	var frames []*Message
+	add := func(m *Message) {
+		if m != nil {
+			frames = append(frames, m)
+		}
+	}
+	for _, t := range cycleTopics {
+		if topics[t] {
+			add(newMessage("", t, t, statePayload(t, d)))
+		}
+	}
+	if topics["lan"] {
+		res := lan.Cached()
+		if !audit {
+			res = res.WithoutServices()
+		}
+		add(newMessage("", "lan", "lan", res))
+	}
+
+	if missed, ok := h.missedSince(lastEventID); ok {
+		for _, e := range missed {
+			if topics[e.msg.Topic] {
+				frames = append(frames, e.msg)
+			}
+		}
+		return frames
+	}
+	// 首次连接或无法补发：发送完整列表，并带上当前事件 ID 作为之后重连的起点
+	id := h.eventID(h.seq)
+	if topics["alerts"] {
+		alerts := d.Alerts
+		if alerts == nil {
+			alerts = []metrics.AlertInfo{}
+		}
+		add(newMessage(id, "alerts", "alerts", alerts))
+	}
+	if topics["netlog"] {
+		netLog := h.netLog
+		if netLog == nil {
+			netLog = []metrics.NetLogEntry{}
+		}
+		add(newMessage(id, "netlog", "netlog", netLog))
+	}
+	return frames
+}
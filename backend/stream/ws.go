@@ -0,0 +1,344 @@
+package stream
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"system-monitor/lan"
+	"system-monitor/metrics"
+
+	"github.com/gorilla/websocket"
+)
+
+// WebSocket 推送：事件与按主题订阅的 SSE 相同，消息格式为 {"event": ..., "id": ..., "data": ...}。
+// 客户端可随时发送命令（{"cmd": ..., "req": "可选的请求标识"}），服务端以 reply 事件应答：
+//
+//	{"cmd": "subscribe", "topics": ["perf", "alerts"]}          修改订阅主题
+//	{"cmd": "rate", "interval": "5s"}                           状态类主题最多每隔 interval 推送一次，"0s" 表示每周期推送
+//	{"cmd": "filter", "disks": ["/"], "interfaces": ["eth0"], "alert_levels": ["critical"]}  只推送匹配的磁盘 / 网卡 / 告警，空列表表示不过滤
+//	{"cmd": "rescan"}                                           在后台重新扫描局域网，完成后通过 lan 主题推送结果（admin）
+//	{"cmd": "ack", "id": "告警 ID"}                              以当前用户名确认告警（operator）
+
+const (
+	wsWriteWait  = 10 * time.Second
+	wsPongWait   = 60 * time.Second
+	wsPingPeriod = wsPongWait * 9 / 10
+	wsMaxRate    = time.Hour
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+	// 默认的 CheckOrigin 要求 Origin 与 Host 一致，防止其他站点借用浏览器的登录 Cookie。
+	// 反向代理需保留原始 Host（nginx.conf）；Vite 开发代理改写了 Host，同时把 Origin 改写为后端地址
+}
+
+// Permissions 是调用方在 WebSocket 上可执行的操作，由路由层按角色确定
+type Permissions struct {
+	Username string
+	Audit    bool // 可订阅 netlog / geo，lan 主题包含服务探测结果
+	Ack      bool // 可确认告警
+	Rescan   bool // 可触发局域网扫描
+}
+
+type wsCommand struct {
+	Cmd         string   `json:"cmd"`
+	Req         string   `json:"req,omitempty"`
+	Topics      []string `json:"topics,omitempty"`
+	Interval    string   `json:"interval,omitempty"`
+	Disks       []string `json:"disks,omitempty"`
+	Interfaces  []string `json:"interfaces,omitempty"`
+	AlertLevels []string `json:"alert_levels,omitempty"`
+	ID          string   `json:"id,omitempty"`
+}
+
+type wsReply struct {
+	Cmd    string      `json:"cmd"`
+	Req    string      `json:"req,omitempty"`
+	OK     bool        `json:"ok"`
+	Error  string      `json:"error,omitempty"`
+	Result interface{} `json:"result,omitempty"`
+}
+
+// wsFilter 在发送前按客户端设置过滤数据，仅在设置了过滤条件时才重新编码
+type wsFilter struct {
+	disks, interfaces, levels map[string]bool
+}
+
+type wsClient struct {
+	conn    *websocket.Conn
+	sub     *Subscriber
+	perms   Permissions
+	replies chan *Message // 命令应答，由写协程发送
+	cmds    chan wsCommand
+	done    chan struct{} // 写协程退出时关闭
+
+	rate     time.Duration
+	filter   wsFilter
+	pending  map[string]*Message // 因限速暂缓发送的状态事件，只保留最新一条
+	lastSent map[string]time.Time
+}
+
+// ServeWS 升级连接并在当前协程中推送事件直到连接关闭。topics 需已按 Permissions 校验。
+func ServeWS(w http.ResponseWriter, r *http.Request, topics []string, lastEventID string, perms Permissions) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return // Upgrade 已返回 HTTP 错误
+	}
+	defer conn.Close()
+
+	c := &wsClient{
+		conn:     conn,
+		sub:      SubscribeTopics(topics, lastEventID, perms.Audit),
+		perms:    perms,
+		replies:  make(chan *Message, 16),
+		cmds:     make(chan wsCommand, 16),
+		done:     make(chan struct{}),
+		pending:  make(map[string]*Message),
+		lastSent: make(map[string]time.Time),
+	}
+	defer Unsubscribe(c.sub)
+
+	quit := make(chan struct{})
+	go c.readLoop(quit)
+	c.writeLoop(quit)
+	close(c.done)
+}
+
+// readLoop 读取客户端命令，连接断开时关闭 quit
+func (c *wsClient) readLoop(quit chan struct{}) {
+	defer close(quit)
+	c.conn.SetReadLimit(64 << 10)
+	c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+	for {
+		_, b, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var cmd wsCommand
+		if err := json.Unmarshal(b, &cmd); err != nil {
+			c.reply(wsReply{Cmd: "invalid", Error: err.Error()})
+			continue
+		}
+		// 过滤与限速状态只由写协程访问；写协程已退出时不再等待
+		if cmd.Cmd == "rate" || cmd.Cmd == "filter" {
+			select {
+			case c.cmds <- cmd:
+			case <-c.done:
+				return
+			}
+			continue
+		}
+		c.reply(c.execute(cmd))
+	}
+}
+
+func (c *wsClient) writeLoop(quit chan struct{}) {
+	ping := time.NewTicker(wsPingPeriod)
+	defer ping.Stop()
+	flush := time.NewTicker(250 * time.Millisecond)
+	defer flush.Stop()
+
+	for {
+		var err error
+		select {
+		case <-quit:
+			return
+		case <-c.sub.Done():
+			c.conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "client too slow"), time.Now().Add(wsWriteWait))
+			return
+		case msg := <-c.sub.C():
+			err = c.send(msg)
+		case msg := <-c.replies:
+			err = c.write(msg.JSON())
+		case cmd := <-c.cmds:
+			err = c.write(newMessage("", "reply", "", c.configure(cmd)).JSON())
+		case <-flush.C:
+			err = c.flushPending()
+		case <-ping.C:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			err = c.conn.WriteMessage(websocket.PingMessage, nil)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (c *wsClient) write(b []byte) error {
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	return c.conn.WriteMessage(websocket.TextMessage, b)
+}
+
+// send 对状态事件执行限速，对所有事件执行过滤
+func (c *wsClient) send(msg *Message) error {
+	if msg.ID == "" && c.rate > 0 && msg.Topic != "" {
+		if time.Since(c.lastSent[msg.Topic]) < c.rate {
+			c.pending[msg.Topic] = msg
+			return nil
+		}
+		delete(c.pending, msg.Topic)
+		c.lastSent[msg.Topic] = time.Now()
+	}
+	msg = c.filter.apply(msg)
+	if msg == nil {
+		return nil
+	}
+	return c.write(msg.JSON())
+}
+
+func (c *wsClient) flushPending() error {
+	for topic, msg := range c.pending {
+		if time.Since(c.lastSent[topic]) < c.rate {
+			continue
+		}
+		if err := c.send(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *wsClient) reply(r wsReply) {
+	if m := newMessage("", "reply", "", r); m != nil {
+		select {
+		case c.replies <- m:
+		default: // 客户端发送命令过快，丢弃应答
+		}
+	}
+}
+
+// configure 处理 rate / filter 命令，在写协程中执行
+func (c *wsClient) configure(cmd wsCommand) wsReply {
+	r := wsReply{Cmd: cmd.Cmd, Req: cmd.Req}
+	switch cmd.Cmd {
+	case "rate":
+		d, err := time.ParseDuration(cmd.Interval)
+		if err != nil || d < 0 || d > wsMaxRate {
+			r.Error = "interval must be a duration between 0s and 1h"
+			return r
+		}
+		c.rate = d
+		if d == 0 {
+			for _, msg := range c.pending {
+				c.send(msg)
+			}
+			c.pending = make(map[string]*Message)
+		}
+	case "filter":
+		c.filter = wsFilter{disks: toSet(cmd.Disks), interfaces: toSet(cmd.Interfaces), levels: toSet(cmd.AlertLevels)}
+	}
+	r.OK = true
+	return r
+}
+
+// execute 处理其余命令，在读协程中执行
+func (c *wsClient) execute(cmd wsCommand) wsReply {
+	r := wsReply{Cmd: cmd.Cmd, Req: cmd.Req}
+	switch cmd.Cmd {
+	case "subscribe":
+		for _, t := range cmd.Topics {
+			if !validTopic(t) {
+				r.Error = fmt.Sprintf("unknown topic %q", t)
+				return r
+			}
+			if AuditTopic(t) && !c.perms.Audit {
+				r.Error = "topic " + t + " requires role operator"
+				return r
+			}
+		}
+		SetTopics(c.sub, cmd.Topics)
+	case "rescan":
+		if !c.perms.Rescan {
+			r.Error = "requires role admin"
+			return r
+		}
+		lan.Rescan() // 立即返回，扫描完成后通过 lan 主题推送
+	case "ack":
+		if !c.perms.Ack {
+			r.Error = "requires role operator"
+			return r
+		}
+		a, err := metrics.AckAlert(cmd.ID, c.perms.Username)
+		if err != nil && !errors.Is(err, metrics.ErrAlertResolved) {
+			r.Error = err.Error()
+			return r
+		}
+		r.Result = a
+		if err != nil {
+			r.Error = err.Error()
+			return r
+		}
+	default:
+		r.Error = fmt.Sprintf("unknown cmd %q", cmd.Cmd)
+		return r
+	}
+	r.OK = true
+	return r
+}
+
+func toSet(list []string) map[string]bool {
+	if len(list) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(list))
+	for _, v := range list {
+		set[v] = true
+	}
+	return set
+}
+
+// apply 返回过滤后的事件，全部被过滤掉的追加事件返回 nil
+func (f wsFilter) apply(msg *Message) *Message {
+	switch {
+	case msg.Event == "disks" && f.disks != nil:
+		var list []metrics.DiskInfo
+		if json.Unmarshal(msg.Data, &list) != nil {
+			return msg
+		}
+		kept := []metrics.DiskInfo{}
+		for _, d := range list {
+			if f.disks[d.Path] {
+				kept = append(kept, d)
+			}
+		}
+		return newMessage(msg.ID, msg.Event, msg.Topic, kept)
+	case msg.Event == "network" && f.interfaces != nil:
+		var list []metrics.NetworkInfo
+		if json.Unmarshal(msg.Data, &list) != nil {
+			return msg
+		}
+		kept := []metrics.NetworkInfo{}
+		for _, n := range list {
+			if f.interfaces[n.Interface] {
+				kept = append(kept, n)
+			}
+		}
+		return newMessage(msg.ID, msg.Event, msg.Topic, kept)
+	case msg.Event == "alerts" && f.levels != nil:
+		var list []metrics.AlertInfo
+		if json.Unmarshal(msg.Data, &list) != nil {
+			return msg
+		}
+		kept := []metrics.AlertInfo{}
+		for _, a := range list {
+			if f.levels[a.Level] {
+				kept = append(kept, a)
+			}
+		}
+		return newMessage(msg.ID, msg.Event, msg.Topic, kept)
+	case msg.Event == "alert" && f.levels != nil:
+		var ev metrics.AlertEvent
+		if json.Unmarshal(msg.Data, &ev) == nil && !f.levels[ev.Alert.Level] {
+			return nil
+		}
+	}
+	return msg
+}
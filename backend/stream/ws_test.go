@@ -0,0 +1,232 @@
+package stream
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"system-monitor/metrics"
+
+	"github.com/gorilla/websocket"
+)
+
+// testConn 是测试用的 WebSocket 客户端，读协程把收到的消息放入 msgs
+type testConn struct {
+	*websocket.Conn
+	msgs chan *wsEnvelope
+}
+
+// serveWS 启动一个按给定权限服务的 WebSocket 端点，测试结束时等待所有连接的处理函数退出
+func serveWS(t *testing.T, topics []string, perms Permissions) string {
+	t.Helper()
+	var wg sync.WaitGroup
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wg.Add(1)
+		defer wg.Done()
+		ServeWS(w, r, topics, "", perms)
+	}))
+	t.Cleanup(func() {
+		srv.Close()
+		wg.Wait()
+	})
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+// dialWS 连接新的端点，读完连接时的初始数据后返回
+func dialWS(t *testing.T, topics []string, perms Permissions) *testConn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial(serveWS(t, topics, perms), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	c := &testConn{Conn: conn, msgs: make(chan *wsEnvelope, 64)}
+	go func() {
+		defer close(c.msgs)
+		for {
+			var env wsEnvelope
+			if err := conn.ReadJSON(&env); err != nil {
+				return
+			}
+			c.msgs <- &env
+		}
+	}()
+	for range topics {
+		if c.next(time.Second) == nil {
+			t.Fatal("no initial frame")
+		}
+	}
+	return c
+}
+
+// next 返回下一条消息，超时或连接关闭时返回 nil
+func (c *testConn) next(timeout time.Duration) *wsEnvelope {
+	select {
+	case env := <-c.msgs:
+		return env
+	case <-time.After(timeout):
+		return nil
+	}
+}
+
+// command 发送命令并返回应答
+func command(t *testing.T, c *testConn, cmd string) wsReply {
+	t.Helper()
+	if err := c.WriteMessage(websocket.TextMessage, []byte(cmd)); err != nil {
+		t.Fatal(err)
+	}
+	// 订阅新主题时初始数据可能先于应答到达
+	env := c.next(time.Second)
+	for env != nil && env.Event != "reply" {
+		env = c.next(time.Second)
+	}
+	if env == nil {
+		t.Fatalf("no reply to %s", cmd)
+	}
+	var r wsReply
+	if err := json.Unmarshal(env.Data, &r); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func publishState(topic string, v interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.publishState(topic, v)
+}
+
+func TestWSPermissions(t *testing.T) {
+	resetHub(t)
+	tests := []struct {
+		name    string
+		perms   Permissions
+		cmd     string
+		wantOK  bool
+		wantErr string
+	}{
+		{"viewer subscribes", Permissions{}, `{"cmd":"subscribe","topics":["perf","lan"],"req":"r1"}`, true, ""},
+		{"viewer audit topic", Permissions{}, `{"cmd":"subscribe","topics":["perf","netlog"]}`, false, "topic netlog requires role operator"},
+		{"unknown topic", Permissions{Audit: true}, `{"cmd":"subscribe","topics":["cpu"]}`, false, `unknown topic "cpu"`},
+		{"operator audit topic", Permissions{Audit: true}, `{"cmd":"subscribe","topics":["netlog"]}`, true, ""},
+		{"viewer rescan", Permissions{}, `{"cmd":"rescan"}`, false, "requires role admin"},
+		{"operator rescan", Permissions{Audit: true, Ack: true}, `{"cmd":"rescan"}`, false, "requires role admin"},
+		{"viewer ack", Permissions{}, `{"cmd":"ack","id":"x"}`, false, "requires role operator"},
+		{"operator ack unknown alert", Permissions{Username: "alice", Ack: true}, `{"cmd":"ack","id":"x"}`, false, "alert not found"},
+		{"viewer filter", Permissions{}, `{"cmd":"filter","disks":["/"]}`, true, ""},
+		{"bad rate", Permissions{}, `{"cmd":"rate","interval":"2h"}`, false, "between 0s and 1h"},
+		{"unknown cmd", Permissions{}, `{"cmd":"reboot"}`, false, `unknown cmd "reboot"`},
+		{"invalid json", Permissions{}, `{"cmd":`, false, "unexpected end"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := dialWS(t, []string{"perf"}, tt.perms)
+			r := command(t, conn, tt.cmd)
+			if r.OK != tt.wantOK || !strings.Contains(r.Error, tt.wantErr) {
+				t.Errorf("reply = %+v, want ok=%v error %q", r, tt.wantOK, tt.wantErr)
+			}
+			if strings.Contains(tt.cmd, `"req":"r1"`) && r.Req != "r1" {
+				t.Errorf("req = %q, want r1", r.Req)
+			}
+		})
+	}
+}
+
+func TestWSFilter(t *testing.T) {
+	resetHub(t)
+	conn := dialWS(t, []string{"disks"}, Permissions{})
+	if r := command(t, conn, `{"cmd":"filter","disks":["/data"]}`); !r.OK {
+		t.Fatalf("filter: %+v", r)
+	}
+	publishState("disks", []metrics.DiskInfo{{Path: "/"}, {Path: "/data"}})
+	env := conn.next(time.Second)
+	if env == nil || env.Event != "disks" {
+		t.Fatalf("got %+v", env)
+	}
+	var disks []metrics.DiskInfo
+	if err := json.Unmarshal(env.Data, &disks); err != nil || len(disks) != 1 || disks[0].Path != "/data" {
+		t.Errorf("disks = %+v, %v", disks, err)
+	}
+}
+
+func TestWSRateLimit(t *testing.T) {
+	resetHub(t)
+	conn := dialWS(t, []string{"perf"}, Permissions{})
+	if r := command(t, conn, `{"cmd":"rate","interval":"600ms"}`); !r.OK {
+		t.Fatalf("rate: %+v", r)
+	}
+	perf := func(usage float64) perfPayload { return perfPayload{CPU: metrics.CPUInfo{Usage: usage}} }
+	usage := func(env *wsEnvelope) float64 {
+		var p perfPayload
+		json.Unmarshal(env.Data, &p)
+		return p.CPU.Usage
+	}
+
+	// 第一条立即发送，之后间隔内的只保留最新一条，到期后由定时器补发
+	publishState("perf", perf(1))
+	if env := conn.next(time.Second); env == nil || usage(env) != 1 {
+		t.Fatalf("first = %+v", env)
+	}
+	publishState("perf", perf(2))
+	publishState("perf", perf(3))
+	if env := conn.next(300 * time.Millisecond); env != nil {
+		t.Fatalf("sent within interval: %s", env.Data)
+	}
+	env := conn.next(time.Second)
+	if env == nil || usage(env) != 3 {
+		t.Fatalf("flushed = %+v, want latest pending", env)
+	}
+	if env := conn.next(800 * time.Millisecond); env != nil {
+		t.Fatalf("superseded event sent: %s", env.Data)
+	}
+
+	// 恢复每周期推送时立即发出暂缓的事件
+	publishState("perf", perf(4))
+	publishState("perf", perf(5))
+	if env := conn.next(time.Second); env == nil || usage(env) != 4 {
+		t.Fatalf("got %+v, want 4", env)
+	}
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"cmd":"rate","interval":"0s"}`))
+	var got []string
+	for i := 0; i < 2; i++ {
+		env := conn.next(time.Second)
+		if env == nil {
+			break
+		}
+		got = append(got, env.Event)
+		if env.Event == "perf" && usage(env) != 5 {
+			t.Errorf("flushed usage = %v, want 5", usage(env))
+		}
+	}
+	if strings.Join(got, ",") != "perf,reply" {
+		t.Errorf("after rate 0s got %v, want pending perf then reply", got)
+	}
+}
+
+func TestWSOrigin(t *testing.T) {
+	resetHub(t)
+	url := serveWS(t, []string{"perf"}, Permissions{})
+	tests := []struct {
+		origin string
+		ok     bool
+	}{
+		{"http" + strings.TrimPrefix(url, "ws"), true},
+		{"http://localhost:5173", false}, // 开发服务器代理需改写 Origin
+		{"https://evil.example.com", false},
+	}
+	for _, tt := range tests {
+		conn, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {tt.origin}})
+		if (err == nil) != tt.ok {
+			t.Errorf("origin %s: err = %v", tt.origin, err)
+		}
+		if err == nil {
+			conn.Close()
+		} else if resp != nil && resp.StatusCode != http.StatusForbidden {
+			t.Errorf("origin %s: status %d", tt.origin, resp.StatusCode)
+		}
+	}
+}
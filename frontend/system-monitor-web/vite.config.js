@@ -1,13 +1,27 @@
 import { defineConfig } from 'vite'
 import vue from '@vitejs/plugin-vue'
 
+const backend = 'http://localhost:8080'
+
 export default defineConfig({
   plugins: [vue()],
   server: {
     port: 5173,
     proxy: {
+      // WebSocket 需放在 /api 之前。changeOrigin 只改写 Host，浏览器发送的 Origin 仍是开发服务器地址，
+      // 后端的同源校验会拒绝握手，因此把 Origin 一并改写为后端地址（后端不为开发环境放宽校验）
+      '/api/ws': {
+        target: backend,
+        ws: true,
+        changeOrigin: true,
+        configure: (proxy) => {
+          proxy.on('proxyReqWs', (proxyReq) => {
+            proxyReq.setHeader('Origin', backend)
+          })
+        }
+      },
       '/api': {
-        target: 'http://localhost:8080',
+        target: backend,
         changeOrigin: true,
       }
     }